@@ -0,0 +1,197 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/adamcolton/fixme/fixme"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// commands are run from the command line as "fixme <command> [args]". With
+// no command, fixme runs the web server.
+var commands = map[string]func(args []string){
+	"export": exportProject,
+	"import": importProject,
+	"init":   initProject,
+	"link":   linkProject,
+	"lsp":    lsp,
+	"tui":    tuiMain,
+	"worker": worker,
+}
+
+// initProject creates a project from a directory, defaulting to the working
+// directory.
+func initProject(args []string) {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	p, err := fixme.NewProjectFromDir(dir)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Created project %q with %d packages\n", p.Name(), len(p.ProjectRecord().Pkgs))
+}
+
+// worker runs jobs for a fixme started with -worker pointing at it. The
+// packages are run in the checkout at -root, which is kept in sync with the
+// coordinator's -worker-root separately.
+func worker(args []string) {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:6061", "address to take jobs on")
+	root := fs.String("root", ".", "checkout to run jobs in")
+	env := fs.String("allow-env", "", "comma separated environment variables jobs can set, as well as "+strings.Join(fixme.DefaultWorkerEnv, ", "))
+	fs.Parse(args)
+
+	wk, err := fixme.NewWorker(*root)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, name := range strings.Split(*env, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			wk.Env[name] = true
+		}
+	}
+	mux := http.NewServeMux()
+	mux.Handle(fixme.WorkerPath, wk)
+	fmt.Println("Worker running", wk.Root, "on", *addr)
+	fmt.Println(http.ListenAndServe(*addr, mux))
+	os.Exit(1)
+}
+
+// exportProject writes the named project to a file, or to stdout if no file is
+// given. The format comes from the file's extension unless -format is set.
+func exportProject(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "", "json or yaml")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fmt.Println("usage: fixme export [-format json|yaml] <project> [file]")
+		os.Exit(1)
+	}
+	file := fs.Arg(1)
+	if *format == "" {
+		*format = fixme.ExportFormat(file)
+	}
+
+	pr, err := recordByName(fs.Arg(0))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	dir := ""
+	if file != "" {
+		dir, _ = filepath.Abs(filepath.Dir(file))
+	}
+	data, err := fixme.Export(pr, *format, dir)
+	if err == nil {
+		if file == "" {
+			_, err = os.Stdout.Write(data)
+		} else {
+			err = ioutil.WriteFile(file, data, 0644)
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func projectByName(name string) (*fixme.Project, error) {
+	pr, err := recordByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return fixme.Load(pr.ID)
+}
+
+// recordByName returns the named project as it's stored.
+func recordByName(name string) (fixme.ProjectRecord, error) {
+	list, err := fixme.List()
+	if err != nil {
+		return fixme.ProjectRecord{}, err
+	}
+	for _, pr := range list {
+		if pr.Name == name {
+			return fixme.LoadRecord(pr.ID)
+		}
+	}
+	return fixme.ProjectRecord{}, fmt.Errorf("no project named %q", name)
+}
+
+// importProject creates a project from a file written by export, or from stdin
+// if the file is "-".
+func importProject(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "", "json or yaml")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Println("usage: fixme import [-format json|yaml] <file>")
+		os.Exit(1)
+	}
+	file := fs.Arg(0)
+	if *format == "" {
+		*format = fixme.ExportFormat(file)
+	}
+
+	var data []byte
+	var err error
+	dir := "."
+	if file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+		dir = filepath.Dir(file)
+	}
+	if err == nil {
+		dir, err = filepath.Abs(dir)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	p, missing, err := fixme.Import(data, *format, dir)
+	for _, imp := range missing {
+		fmt.Println("Could not find", imp)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Imported project %q with %d packages\n", p.Name(), len(p.ProjectRecord().Pkgs))
+	p.Close()
+}
+
+// linkProject links the named project to the config file in a directory,
+// defaulting to the working directory.
+func linkProject(args []string) {
+	if len(args) < 1 {
+		fmt.Println("usage: fixme link <project> [dir]")
+		os.Exit(1)
+	}
+	dir := "."
+	if len(args) > 1 {
+		dir = args[1]
+	}
+	p, err := projectByName(args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	missing, err := p.LinkConfig(dir)
+	for _, imp := range missing {
+		fmt.Println("Could not find", imp)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Linked project %q to %s\n", p.Name(), fixme.ConfigName)
+	p.Close()
+}
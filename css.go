@@ -3,4 +3,71 @@ package main
 var css = []byte(` 
 form.form-inline{
 	padding-top: 10px;
+}
+ul.diagnostics{
+	list-style: none;
+	padding-left: 0;
+}
+li.diagnostic{
+	padding: 4px 0;
+	border-bottom: 1px solid #eee;
+}
+li.diagnostic pre{
+	margin: 4px 0 0 0;
+}
+li.diagnostic .tool{
+	font-weight: bold;
+	text-transform: uppercase;
+}
+li.diagnostic.error .tool{
+	color: #a94442;
+}
+li.diagnostic.warning .tool{
+	color: #8a6d3b;
+}
+pre.source{
+	background-color: #fafafa;
+}
+li.diagnostic a[data-line]{
+	cursor: pointer;
+	color: inherit;
+	text-decoration: none;
+}
+li.diagnostic a.location:hover{
+	text-decoration: underline;
+}
+pre.source .highlight{
+	display: inline-block;
+	width: 100%;
+	background-color: #fcf8e3;
+}
+pre.source .lineno{
+	display: inline-block;
+	width: 4em;
+	color: #999;
+}
+p.blocked{
+	color: #999;
+	margin-top: 10px;
+}
+a.rerun-package{
+	cursor: pointer;
+	font-size: small;
+	margin-left: 10px;
+}
+a.raw-toggle{
+	cursor: pointer;
+}
+#store-error{
+	position: fixed;
+	top: 60px;
+	left: 20px;
+	right: 20px;
+	z-index: 1000;
+}
+#store-error a.close{
+	cursor: pointer;
+}
+table.history tr.past-run{
+	cursor: pointer;
 }`)
@@ -1,122 +1,274 @@
 package fixme
 
 import (
+	"encoding/binary"
 	"encoding/gob"
+	"errors"
 	"github.com/adamcolton/gothic/bufpool"
 	"github.com/boltdb/bolt"
 	"os"
+	"path/filepath"
+	"time"
 )
 
-var db *bolt.DB
-
 var (
 	projectsBucket = []byte("pb")
 	settingsBucket = []byte("st")
+	indexBucket    = []byte("ix")
+	historyBucket  = []byte("hs")
 )
 
-func boltInit() {
-	var err error
-	if home := os.Getenv("HOME"); home != "" {
-		os.Chdir(home)
+// BoltStore is a Store that keeps projects in a Bolt database. It also keeps
+// the package index and the history of runs.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// ErrStoreLocked is returned when the database is already open in another
+// process, usually another fixme.
+var ErrStoreLocked = errors.New("the project database is in use by another fixme")
+
+// boltTimeout is how long to wait for another process to close the database.
+const boltTimeout = time.Second
+
+// OpenBoltStore opens the database at path, creating it and its directory if
+// needed.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{
+		Timeout: boltTimeout,
+	})
+	if err == bolt.ErrTimeout {
+		return nil, ErrStoreLocked
 	}
-	db, err = bolt.Open("projects.db", 0600, nil)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx *bolt.Tx) error {
 		if _, err := tx.CreateBucketIfNotExists(projectsBucket); err != nil {
 			return err
 		}
 		if _, err := tx.CreateBucketIfNotExists(settingsBucket); err != nil {
 			return err
 		}
-		return nil
+		if _, err := tx.CreateBucketIfNotExists(indexBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(historyBucket); err != nil {
+			return err
+		}
+		return migrate(tx)
 	})
-}
-
-func (p *Project) Save() {
-	if db == nil {
-		boltInit()
+	if err != nil {
+		db.Close()
+		return nil, err
 	}
+	return &BoltStore{db}, nil
+}
 
+func (s *BoltStore) Save(pr ProjectRecord) error {
 	buf := bufpool.Get()
-	pr := p.ProjectRecord()
-	pr.ID = nil
-	gob.NewEncoder(buf).Encode(pr)
-	data := buf.Bytes()
-	bufpool.Put(buf)
+	if err := gob.NewEncoder(buf).Encode(toStored(pr)); err != nil {
+		bufpool.Put(buf)
+		return err
+	}
+	data := bufpool.PutAndCopy(buf)
 
-	db.Update(func(tx *bolt.Tx) error {
-		bkt := tx.Bucket(projectsBucket)
-		bkt.Put(p.id, data)
-		return nil
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(projectsBucket).Put(pr.ID, data)
 	})
 }
 
-func (p *Project) Delete() {
-	if db == nil {
-		boltInit()
-	}
-
-	db.Update(func(tx *bolt.Tx) error {
-		bkt := tx.Bucket(projectsBucket)
-		bkt.Delete(p.id)
-		return nil
+func (s *BoltStore) Load(id []byte) (ProjectRecord, error) {
+	var pr ProjectRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(projectsBucket).Get(id)
+		if data == nil {
+			return ErrProjectNotFound
+		}
+		return decodeProject(id, data, &pr)
 	})
+	pr.ID = id
+	return pr, err
 }
 
-func Load(id []byte) *Project {
-	if db == nil {
-		boltInit()
-	}
+func (s *BoltStore) Delete(id []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(historyBucket).DeleteBucket(id)
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		return tx.Bucket(projectsBucket).Delete(id)
+	})
+}
 
-	var data []byte
-	db.View(func(tx *bolt.Tx) error {
-		bkt := tx.Bucket(projectsBucket)
-		if id == nil {
-			c := bkt.Cursor()
-			id, data = c.First()
-		} else {
-			data = bkt.Get(id)
+func (s *BoltStore) List() ([]ProjectRecord, error) {
+	projects := make([]ProjectRecord, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(projectsBucket).Cursor()
+		for id, data := c.First(); id != nil; id, data = c.Next() {
+			// the id is only valid during the transaction
+			id = append([]byte(nil), id...)
+			var pr ProjectRecord
+			if err := decodeProject(id, data, &pr); err != nil {
+				return err
+			}
+			projects = append(projects, pr)
 		}
 		return nil
 	})
+	return projects, err
+}
 
-	if id == nil {
-		return NewProject()
-	}
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
 
+func decodeProject(id, data []byte, pr *ProjectRecord) error {
 	buf := bufpool.Get()
 	buf.Write(data)
-	var pr ProjectRecord
-	gob.NewDecoder(buf).Decode(&pr)
+	var sp storedProject
+	err := gob.NewDecoder(buf).Decode(&sp)
 	bufpool.Put(buf)
-
-	return pr.Project(id)
-}
-
-func List() []ProjectRecord {
-	if db == nil {
-		boltInit()
+	if err != nil {
+		return err
 	}
+	*pr, err = sp.record(id)
+	return err
+}
 
-	projects := make([]ProjectRecord, 0)
-	db.View(func(tx *bolt.Tx) error {
-		bkt := tx.Bucket(projectsBucket)
+// loadIndexCache returns the package index records saved by saveIndexCache,
+// keyed by directory.
+func (s *BoltStore) loadIndexCache() map[string]indexRecord {
+	cache := make(map[string]indexRecord)
+	s.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(indexBucket)
 		c := bkt.Cursor()
-		for id, data := c.First(); id != nil; id, data = c.Next() {
+		for path, data := c.First(); path != nil; path, data = c.Next() {
 			buf := bufpool.Get()
 			buf.Write(data)
-			var pr ProjectRecord
-			gob.NewDecoder(buf).Decode(&pr)
+			var rec indexRecord
+			err := gob.NewDecoder(buf).Decode(&rec)
 			bufpool.Put(buf)
+			if err == nil {
+				cache[string(path)] = rec
+			}
+		}
+		return nil
+	})
+	return cache
+}
 
-			pr.Pkgs = nil
-			pr.ID = id
-			projects = append(projects, pr)
+// saveIndexCache replaces the cached package index.
+func (s *BoltStore) saveIndexCache(records map[string]indexRecord) {
+	s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(indexBucket); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		bkt, err := tx.CreateBucket(indexBucket)
+		if err != nil {
+			return err
+		}
+		for path, rec := range records {
+			buf := bufpool.Get()
+			gob.NewEncoder(buf).Encode(rec)
+			if err := bkt.Put([]byte(path), bufpool.PutAndCopy(buf)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// saveRun adds rec to the project's history, which is a bucket of runs keyed
+// by ID, and deletes the runs keep no longer allows. rec.ID is set.
+func (s *BoltStore) saveRun(project []byte, rec *RunRecord, keep Retention) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.Bucket(historyBucket).CreateBucketIfNotExists(project)
+		if err != nil {
+			return err
+		}
+		var last uint64
+		if k, _ := bkt.Cursor().Last(); k != nil {
+			last = binary.BigEndian.Uint64(k)
+		}
+		rec.ID = runID(rec.Start, last)
+		buf := bufpool.Get()
+		if err := gob.NewEncoder(buf).Encode(rec); err != nil {
+			bufpool.Put(buf)
+			return err
+		}
+		if err := bkt.Put(runKey(rec.ID), bufpool.PutAndCopy(buf)); err != nil {
+			return err
+		}
+
+		// keys are in order, so the runs to delete are the oldest
+		var keys [][]byte
+		c := bkt.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		now := time.Now()
+		for i, k := range keys {
+			if (keep.Runs <= 0 || len(keys)-i <= keep.Runs) && !keep.expired(binary.BigEndian.Uint64(k), now) {
+				break
+			}
+			if err := bkt.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) runs(project []byte, limit int) ([]RunRecord, error) {
+	runs := make([]RunRecord, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(historyBucket).Bucket(project)
+		if bkt == nil {
+			return nil
+		}
+		c := bkt.Cursor()
+		for k, data := c.Last(); k != nil && (limit <= 0 || len(runs) < limit); k, data = c.Prev() {
+			var rec RunRecord
+			if err := decodeRun(data, &rec); err != nil {
+				return err
+			}
+			runs = append(runs, rec.summary())
 		}
 		return nil
 	})
+	return runs, err
+}
+
+func (s *BoltStore) run(project []byte, id uint64) (RunRecord, error) {
+	var rec RunRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(historyBucket).Bucket(project)
+		if bkt == nil {
+			return ErrRunNotFound
+		}
+		data := bkt.Get(runKey(id))
+		if data == nil {
+			return ErrRunNotFound
+		}
+		return decodeRun(data, &rec)
+	})
+	return rec, err
+}
 
-	return projects
+func runKey(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
+
+func decodeRun(data []byte, rec *RunRecord) error {
+	buf := bufpool.Get()
+	buf.Write(data)
+	err := gob.NewDecoder(buf).Decode(rec)
+	bufpool.Put(buf)
+	return err
 }
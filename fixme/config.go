@@ -0,0 +1,192 @@
+package fixme
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ConfigName is the file at the root of a repo that describes its project. A
+// project linked to the repo takes its packages, patterns, steps, flags and env
+// from the file and reloads it when it changes.
+const ConfigName = ".fixme.yaml"
+
+// repoConfig is the format of ConfigName. Paths and patterns starting with
+// "./" are relative to the repo. Steps sets which checks run and in what
+// order, flags are added to each check's command by step name and env is added
+// to their environment.
+type repoConfig struct {
+	Name     string              `yaml:"name"`
+	Packages []exportPackage     `yaml:"packages"`
+	Patterns []exportPattern     `yaml:"patterns"`
+	Steps    []string            `yaml:"steps"`
+	Flags    map[string][]string `yaml:"flags"`
+	Env      map[string]string   `yaml:"env"`
+}
+
+// projectConfig is a repoConfig ready to apply to a project.
+type projectConfig struct {
+	name     string
+	pkgs     []PackageRecord
+	patterns []Pattern
+	steps    []checkStep
+	flags    map[string][]string
+	env      []string
+}
+
+// HasConfig reports whether dir has a ConfigName file.
+func HasConfig(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ConfigName))
+	return err == nil
+}
+
+func loadConfig(dir string) (*projectConfig, error) {
+	file := filepath.Join(dir, ConfigName)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rc repoConfig
+	if err := yaml.UnmarshalStrict(data, &rc); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	cfg := &projectConfig{
+		name:  rc.Name,
+		flags: rc.Flags,
+	}
+	if cfg.pkgs, err = parsePackages(rc.Packages, dir); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	if cfg.patterns, _, err = parsePatterns(rc.Patterns, dir); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	for _, name := range rc.Steps {
+		step, ok := stepByName(name)
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown step %q", file, name)
+		}
+		cfg.steps = append(cfg.steps, step)
+	}
+	for tool := range rc.Flags {
+		if _, ok := stepByName(tool); !ok {
+			return nil, fmt.Errorf("%s: flags for unknown step %q", file, tool)
+		}
+	}
+	for k, v := range rc.Env {
+		cfg.env = append(cfg.env, k+"="+v)
+	}
+	sort.Strings(cfg.env)
+	return cfg, nil
+}
+
+func stepByName(name string) (checkStep, bool) {
+	for _, step := range checkOrder {
+		if step.name == name {
+			return step, true
+		}
+	}
+	return checkStep{}, false
+}
+
+// LinkConfig makes the ConfigName file in dir the source of the project's
+// packages and settings, replacing the ones it has. The import paths of
+// packages in the file that couldn't be found are returned.
+func (p *Project) LinkConfig(dir string) ([]string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := loadConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	p.do(func() {
+		p.configDir = dir
+		missing = p.applyConfig(cfg)
+		if p.watcher != nil {
+			p.watcher.Add(dir)
+		}
+		err = p.save()
+	})
+	return missing, err
+}
+
+func (p *Project) configFile() string {
+	if p.configDir == "" {
+		return ""
+	}
+	return filepath.Join(p.configDir, ConfigName)
+}
+
+// configEdit returns an error if the project is linked to a config file. The
+// packages and patterns of those are changed in the file, anything else would
+// be lost when it's loaded again.
+func (p *Project) configEdit() error {
+	if p.configDir == "" {
+		return nil
+	}
+	return fmt.Errorf("the packages of %s come from %s, change them there", p.name, p.configFile())
+}
+
+// applyConfig replaces the packages and settings of the project with those in
+// cfg and returns the import paths of packages that couldn't be found.
+// Packages that are still in the project keep their state from the last run.
+func (p *Project) applyConfig(cfg *projectConfig) []string {
+	if cfg.name != "" {
+		p.name = cfg.name
+	}
+	if p.watcher != nil {
+		for path := range p.pkgs.byPath {
+			p.watcher.Remove(path)
+		}
+		for _, pt := range p.patterns {
+			if pt.Auto {
+				for _, dir := range pt.Dirs() {
+					p.watcher.Remove(dir)
+				}
+			}
+		}
+		p.watcher.Add(p.configDir)
+	}
+	old := p.pkgs
+	p.pkgs = newPkgMap()
+	missing := p.trackRecords(cfg.pkgs)
+	p.patterns = cfg.patterns
+	for _, pt := range p.patterns {
+		p.addMatches(pt)
+		if pt.Auto {
+			p.watchPattern(pt)
+		}
+	}
+	for imp, pkg := range p.pkgs.byImport {
+		if prev, ok := old.byImport[imp]; ok && prev.Path == pkg.Path {
+			pkg.state, pkg.Data, pkg.Diagnostics = prev.state, prev.Data, prev.Diagnostics
+		}
+	}
+	p.steps = cfg.steps
+	p.flags = cfg.flags
+	p.env = cfg.env
+	p.resolveDependancies()
+	return missing
+}
+
+// reloadConfig applies the config file again after it changed. If it can't be
+// read, the project keeps the config it had.
+func (p *Project) reloadConfig() {
+	cfg, err := loadConfig(p.configDir)
+	if err != nil {
+		fmt.Println(p.name, " Error: ", err)
+		return
+	}
+	for _, imp := range p.applyConfig(cfg) {
+		fmt.Println(p.name, " Error: could not find ", imp)
+	}
+	if err := p.save(); err != nil {
+		fmt.Println(p.name, " Error: ", err)
+	}
+}
@@ -0,0 +1,162 @@
+package fixme
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module example.com/cfg\n",
+		"a/a.go": "package a\n",
+	})
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"not yaml", "name: [", "yaml"},
+		{"unknown field", "nmae: x\n", "nmae"},
+		{"unknown action", "packages:\n- import: example.com/cfg/a\n  action: tset\n", "tset"},
+		{"unknown step", "steps: [build, bench]\n", `unknown step "bench"`},
+		{"flags for an unknown step", "flags:\n  vet: [-all]\n", `unknown step "vet"`},
+	}
+	for _, tt := range tests {
+		writeConfig(t, dir, tt.config)
+		_, err := loadConfig(dir)
+		if err == nil || !strings.Contains(err.Error(), tt.err) || !strings.Contains(err.Error(), ConfigName) {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+	}
+
+	writeConfig(t, dir, `name: cfg
+packages:
+- import: example.com/cfg/a
+  action: lint
+  path: ./a
+patterns:
+- pattern: ./...
+  action: test
+  auto: true
+steps: [test, build]
+flags:
+  test: [-race]
+env:
+  GOOS: linux
+  CGO_ENABLED: "0"
+`)
+	cfg, err := loadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []PackageRecord{{Import: "example.com/cfg/a", Action: Lint, Path: filepath.Join(dir, "a")}}; !reflect.DeepEqual(cfg.pkgs, want) {
+		t.Errorf("got packages %+v", cfg.pkgs)
+	}
+	if want := []Pattern{{Pattern: filepath.Join(dir, "..."), Action: Test, Auto: true}}; !reflect.DeepEqual(cfg.patterns, want) {
+		t.Errorf("got patterns %+v", cfg.patterns)
+	}
+	if len(cfg.steps) != 2 || cfg.steps[0].name != ToolTest || cfg.steps[1].name != ToolBuild {
+		t.Errorf("got steps %v", cfg.steps)
+	}
+	if !reflect.DeepEqual(cfg.flags, map[string][]string{ToolTest: {"-race"}}) {
+		t.Errorf("got flags %v", cfg.flags)
+	}
+	if !reflect.DeepEqual(cfg.env, []string{"CGO_ENABLED=0", "GOOS=linux"}) {
+		t.Errorf("got env %v", cfg.env)
+	}
+}
+
+func writeConfig(t *testing.T, dir, config string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, ConfigName), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	p, _, dir, mod := newTestProject(t)
+	writeConfig(t, dir, "packages:\n- import: "+mod+"/a\n  action: test\n- import: "+mod+"/d\n  action: test\n")
+	if _, err := p.LinkConfig(dir); err != nil {
+		t.Fatal(err)
+	}
+	p.Rerun()
+	if pkg, _ := waitRun(t, p); pkg != nil {
+		t.Fatalf("got %s failing", pkg.Import)
+	}
+
+	// while a run is going the config is kept
+	writeConfig(t, dir, "packages:\n- import: "+mod+"/a\n  action: test\n- import: "+mod+"/b\n  action: lint\n")
+	p.do(func() {
+		p.configChanged = true
+		p.running = true
+		p.refresh()
+		p.running = false
+	})
+	if s := states(p); len(s) != 2 || s[mod+"/d"] != passing {
+		t.Fatalf("config reloaded during a run: %v", s)
+	}
+
+	p.do(p.refresh)
+	s := states(p)
+	if _, ok := s[mod+"/d"]; ok || len(s) != 2 {
+		t.Errorf("got %v after reloading", s)
+	}
+	if s[mod+"/a"] != passing {
+		t.Errorf("a is %s, it passed before the reload", s[mod+"/a"])
+	}
+	if s[mod+"/b"] != notRun {
+		t.Errorf("b is %s before it's been run", s[mod+"/b"])
+	}
+
+	// the name can be read while the config renames the project
+	writeConfig(t, dir, "name: renamed\npackages:\n- import: "+mod+"/a\n  action: test\n")
+	done := make(chan bool)
+	go func() {
+		p.Name()
+		close(done)
+	}()
+	p.do(func() {
+		p.configChanged = true
+		p.refresh()
+	})
+	<-done
+	if name := p.Name(); name != "renamed" {
+		t.Errorf("got name %q after reloading", name)
+	}
+}
+
+func TestConfigLinkedEdits(t *testing.T) {
+	p, _, dir, mod := newTestProject(t)
+	writeConfig(t, dir, "packages:\n- import: "+mod+"/a\n  action: test\n")
+	if _, err := p.LinkConfig(dir); err != nil {
+		t.Fatal(err)
+	}
+	pkg := &Package{Import: mod + "/b", Path: filepath.Join(dir, "b")}
+	a := &Package{Import: mod + "/a", Path: filepath.Join(dir, "a")}
+	edits := map[string]func() error{
+		"AddTest":  func() error { return p.AddTest(pkg) },
+		"AddLint":  func() error { return p.AddLint(a) },
+		"AddWatch": func() error { return p.AddWatch(pkg) },
+		"Remove":   func() error { return p.Remove(a) },
+		"AddPattern": func() error {
+			_, err := p.AddPattern(Pattern{Pattern: dir + "/...", Action: Test})
+			return err
+		},
+	}
+	for name, edit := range edits {
+		if err := edit(); err == nil || !strings.Contains(err.Error(), filepath.Join(dir, ConfigName)) {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+	if s := states(p); len(s) != 1 {
+		t.Errorf("got packages %v", s)
+	}
+	if a := p.Tests(mod + "/a"); a == nil {
+		t.Error("a isn't tested any more")
+	}
+}
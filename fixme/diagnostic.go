@@ -0,0 +1,175 @@
+package fixme
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Severity of a Diagnostic.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Tools that produce diagnostics.
+const (
+	ToolBuild = "build"
+	ToolVet   = "vet"
+	ToolLint  = "lint"
+	ToolTest  = "test"
+)
+
+// Diagnostic is a single problem reported by one of the tools at a location
+// in a file. File is always an absolute path and Column is 0 if the tool
+// didn't report one.
+type Diagnostic struct {
+	File     string
+	Line     int
+	Column   int
+	Severity string
+	Message  string
+	Tool     string
+	Context  []SourceLine
+}
+
+// SourceLine is a line of source shown around a diagnostic. Highlight is set
+// on the line the diagnostic is on.
+type SourceLine struct {
+	Line      int
+	Text      string
+	Highlight bool
+}
+
+// ContextLines is the number of lines before and after a diagnostic that
+// AddContext includes.
+var ContextLines = 3
+
+// String formats the diagnostic as "file:line:col: message", the format most
+// editors understand.
+func (d Diagnostic) String() string {
+	if d.Column == 0 {
+		return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+var diagnosticRe = regexp.MustCompile(`^\s*(vet: )?(\S+\.go):(\d+)(?::(\d+))?: (.*)$`)
+
+// ParseDiagnostics finds the diagnostics in the output of a tool run in dir.
+// Indented lines that follow a diagnostic, like the "have" and "want" lines
+// of a type error, are added to its message. Vet output is recognized in the
+// output of build and test and marked as coming from vet.
+func ParseDiagnostics(dir, tool, output string) []Diagnostic {
+	var ds []Diagnostic
+	severity := SeverityError
+	if tool == ToolLint || tool == ToolVet {
+		severity = SeverityWarning
+	}
+	fromTool := tool
+
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "# ") {
+			// go test puts a header before the output of each package, vet's
+			// header has the package in brackets
+			fromTool = tool
+			if strings.HasPrefix(line, "# [") {
+				fromTool = ToolVet
+			}
+			continue
+		}
+		m := diagnosticRe.FindStringSubmatch(line)
+		if m == nil {
+			trimmed := strings.TrimSpace(line)
+			if len(ds) > 0 && trimmed != "" && (line[0] == ' ' || line[0] == '\t') &&
+				!strings.HasPrefix(trimmed, "---") && !strings.HasPrefix(trimmed, "===") {
+				ds[len(ds)-1].Message += "\n" + trimmed
+			}
+			continue
+		}
+		file := m[2]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		d := Diagnostic{
+			File:     file,
+			Severity: severity,
+			Message:  m[5],
+			Tool:     fromTool,
+		}
+		d.Line, _ = strconv.Atoi(m[3])
+		d.Column, _ = strconv.Atoi(m[4])
+		if m[1] != "" {
+			d.Tool = ToolVet
+		}
+		if d.Tool == ToolVet {
+			d.Severity = SeverityWarning
+		}
+		ds = append(ds, d)
+	}
+	return ds
+}
+
+// Files returns each file that has a diagnostic, once.
+func Files(ds []Diagnostic) []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, d := range ds {
+		if !seen[d.File] {
+			seen[d.File] = true
+			files = append(files, d.File)
+		}
+	}
+	return files
+}
+
+// AddContext sets the Context on each diagnostic to the lines around it. Each
+// file is only read once. Diagnostics in files that can't be read are left
+// without context.
+func AddContext(ds []Diagnostic) {
+	files := make(map[string][]string)
+	for i, d := range ds {
+		lines, ok := files[d.File]
+		if !ok {
+			lines = readLines(d.File)
+			files[d.File] = lines
+		}
+		if d.Line < 1 || d.Line > len(lines) {
+			continue
+		}
+		start, end := d.Line-ContextLines, d.Line+ContextLines
+		if start < 1 {
+			start = 1
+		}
+		if end > len(lines) {
+			end = len(lines)
+		}
+		ctx := make([]SourceLine, 0, end-start+1)
+		for ln := start; ln <= end; ln++ {
+			ctx = append(ctx, SourceLine{
+				Line:      ln,
+				Text:      lines[ln-1],
+				Highlight: ln == d.Line,
+			})
+		}
+		ds[i].Context = ctx
+	}
+}
+
+func readLines(file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var lines []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	return lines
+}
@@ -0,0 +1,119 @@
+package fixme
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	tests := []struct {
+		name   string
+		tool   string
+		output string
+		want   []Diagnostic
+	}{
+		{
+			name:   "build error with column",
+			tool:   ToolBuild,
+			output: "# example.com/m/a\n./a.go:3:9: undefined: x\n",
+			want: []Diagnostic{
+				{File: "/src/a/a.go", Line: 3, Column: 9, Severity: SeverityError, Message: "undefined: x", Tool: ToolBuild},
+			},
+		},
+		{
+			name:   "continuation lines",
+			tool:   ToolBuild,
+			output: "a.go:5:2: cannot use s (type string) as type int\n\thave string\n\twant int\nexit status 2\n",
+			want: []Diagnostic{
+				{File: "/src/a/a.go", Line: 5, Column: 2, Severity: SeverityError, Message: "cannot use s (type string) as type int\nhave string\nwant int", Tool: ToolBuild},
+			},
+		},
+		{
+			name:   "absolute path without column",
+			tool:   ToolTest,
+			output: "--- FAIL: TestA (0.00s)\n    /other/a_test.go:12: got 1\n",
+			want: []Diagnostic{
+				{File: "/other/a_test.go", Line: 12, Severity: SeverityError, Message: "got 1", Tool: ToolTest},
+			},
+		},
+		{
+			name:   "vet in test output",
+			tool:   ToolTest,
+			output: "# [example.com/m/a]\n./a.go:7:2: unreachable code\n# example.com/m/a\n./a.go:8:1: missing return\n",
+			want: []Diagnostic{
+				{File: "/src/a/a.go", Line: 7, Column: 2, Severity: SeverityWarning, Message: "unreachable code", Tool: ToolVet},
+				{File: "/src/a/a.go", Line: 8, Column: 1, Severity: SeverityError, Message: "missing return", Tool: ToolTest},
+			},
+		},
+		{
+			name:   "vet prefix",
+			tool:   ToolBuild,
+			output: "vet: ./a.go:2:1: bad\n",
+			want: []Diagnostic{
+				{File: "/src/a/a.go", Line: 2, Column: 1, Severity: SeverityWarning, Message: "bad", Tool: ToolVet},
+			},
+		},
+		{
+			name:   "lint",
+			tool:   ToolLint,
+			output: "a.go:1:1: should have a package comment\n",
+			want: []Diagnostic{
+				{File: "/src/a/a.go", Line: 1, Column: 1, Severity: SeverityWarning, Message: "should have a package comment", Tool: ToolLint},
+			},
+		},
+		{
+			name:   "test markers aren't part of the message",
+			tool:   ToolTest,
+			output: "    a_test.go:4: first\n    --- FAIL: TestA/sub (0.00s)\n",
+			want: []Diagnostic{
+				{File: "/src/a/a_test.go", Line: 4, Severity: SeverityError, Message: "first", Tool: ToolTest},
+			},
+		},
+		{
+			name:   "nothing to parse",
+			tool:   ToolBuild,
+			output: "ok  \texample.com/m/a\t0.01s\n",
+		},
+	}
+	for _, tt := range tests {
+		got := ParseDiagnostics("/src/a", tt.tool, tt.output)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAddContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.go")
+	if err := ioutil.WriteFile(file, []byte("1\n2\n3\n4\n5\n6\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ds := []Diagnostic{
+		{File: file, Line: 2},
+		{File: file, Line: 9},
+		{File: filepath.Join(dir, "missing.go"), Line: 1},
+	}
+	AddContext(ds)
+	want := []SourceLine{
+		{Line: 1, Text: "1"},
+		{Line: 2, Text: "2", Highlight: true},
+		{Line: 3, Text: "3"},
+		{Line: 4, Text: "4"},
+		{Line: 5, Text: "5"},
+	}
+	if !reflect.DeepEqual(ds[0].Context, want) {
+		t.Errorf("got %v, want %v", ds[0].Context, want)
+	}
+	if ds[1].Context != nil || ds[2].Context != nil {
+		t.Errorf("lines that don't exist got context: %v, %v", ds[1].Context, ds[2].Context)
+	}
+}
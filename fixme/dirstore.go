@@ -0,0 +1,127 @@
+package fixme
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DirStore is a Store that keeps each project as an indented JSON file in a
+// directory, named by its ID, so they can be edited by hand and kept in
+// version control.
+type DirStore struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+// OpenDirStore uses dir to keep projects, creating it if needed.
+func OpenDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DirStore{
+		Dir: dir,
+	}, nil
+}
+
+const dirStoreExt = ".json"
+
+func (s *DirStore) file(id []byte) string {
+	return filepath.Join(s.Dir, hex.EncodeToString(id)+dirStoreExt)
+}
+
+func (s *DirStore) Save(pr ProjectRecord) error {
+	data, err := json.MarshalIndent(toStored(pr), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// write to a temp file first so a crash never leaves half a project
+	tmp, err := ioutil.TempFile(s.Dir, ".fixme")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.file(pr.ID))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (s *DirStore) Load(id []byte) (ProjectRecord, error) {
+	s.mu.Lock()
+	data, err := ioutil.ReadFile(s.file(id))
+	s.mu.Unlock()
+	if os.IsNotExist(err) {
+		return ProjectRecord{ID: id}, ErrProjectNotFound
+	}
+	if err != nil {
+		return ProjectRecord{ID: id}, err
+	}
+	return decodeDirProject(id, data)
+}
+
+func decodeDirProject(id []byte, data []byte) (ProjectRecord, error) {
+	var sp storedProject
+	if err := json.Unmarshal(data, &sp); err != nil {
+		return ProjectRecord{ID: id}, err
+	}
+	return sp.record(id)
+}
+
+func (s *DirStore) Delete(id []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.file(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *DirStore) List() ([]ProjectRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	projects := make([]ProjectRecord, 0, len(infos))
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, dirStoreExt) {
+			continue
+		}
+		id, err := hex.DecodeString(strings.TrimSuffix(name, dirStoreExt))
+		if err != nil {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(s.Dir, name))
+		if err != nil {
+			return projects, err
+		}
+		pr, err := decodeDirProject(id, data)
+		if err != nil {
+			return projects, err
+		}
+		projects = append(projects, pr)
+	}
+	sortRecords(projects)
+	return projects, nil
+}
+
+func (s *DirStore) Close() error {
+	return nil
+}
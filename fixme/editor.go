@@ -0,0 +1,117 @@
+package fixme
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// editorTemplates are the commands used for well known editors when no
+// command is configured. The placeholders {file}, {line} and {col} are
+// replaced with the location to open.
+var editorTemplates = map[string]string{
+	"gvim":        "gvim +{line} {file}",
+	"mvim":        "mvim +{line} {file}",
+	"emacsclient": "emacsclient -n +{line}:{col} {file}",
+	"code":        "code -g {file}:{line}:{col}",
+	"subl":        "subl {file}:{line}:{col}",
+	"atom":        "atom {file}:{line}:{col}",
+}
+
+// terminalEditors need a terminal, which fixme doesn't have when it opens a
+// file. They're replaced with the graphical editor they come with, if it's
+// installed; an empty string means there isn't one.
+var terminalEditors = map[string]string{
+	"vi":    "gvim",
+	"vim":   "gvim",
+	"nvim":  "",
+	"emacs": "emacsclient",
+	"nano":  "",
+	"micro": "",
+	"kak":   "",
+	"hx":    "",
+	"ed":    "",
+}
+
+// EditorCommand returns the command template to use for opening files. If
+// cmd is not empty it is returned, otherwise the template is picked based on
+// $VISUAL or $EDITOR. Terminal editors are replaced by their graphical
+// version, if there isn't one an error is returned.
+func EditorCommand(cmd string) (string, error) {
+	if cmd != "" {
+		return cmd, nil
+	}
+	var terminal string
+	for _, editor := range []string{os.Getenv("VISUAL"), os.Getenv("EDITOR")} {
+		fields := strings.Fields(editor)
+		if len(fields) == 0 {
+			continue
+		}
+		name := filepath.Base(fields[0])
+		if gui, ok := terminalEditors[name]; ok {
+			if gui == "" {
+				terminal = name
+				continue
+			}
+			if _, err := exec.LookPath(gui); err != nil {
+				terminal = name
+				continue
+			}
+			name = gui
+		}
+		if tmpl, ok := editorTemplates[name]; ok {
+			return tmpl, nil
+		}
+		return editor + " {file}", nil
+	}
+	if terminal != "" {
+		return "", errors.New(terminal + " needs a terminal, use the -editor flag or set $VISUAL to a graphical editor")
+	}
+	return "", errors.New("no editor configured, use the -editor flag or set $VISUAL")
+}
+
+// OpenInEditor starts the editor command on the location of the diagnostic.
+// The command is split on whitespace before the placeholders are replaced so
+// file names with spaces are passed as a single argument. Only Go source files
+// can be opened.
+func OpenInEditor(cmd string, d Diagnostic) error {
+	cmd, err := EditorCommand(cmd)
+	if err != nil {
+		return err
+	}
+	tmpl := strings.Fields(cmd)
+	if len(tmpl) == 0 {
+		return errors.New("no editor configured, use the -editor flag or set $VISUAL")
+	}
+	if !strings.HasSuffix(d.File, ".go") {
+		return errors.New("not a Go file: " + d.File)
+	}
+	if _, err := os.Stat(d.File); err != nil {
+		return err
+	}
+	if d.Line < 1 {
+		d.Line = 1
+	}
+	if d.Column < 1 {
+		d.Column = 1
+	}
+	r := strings.NewReplacer(
+		"{file}", d.File,
+		"{line}", strconv.Itoa(d.Line),
+		"{col}", strconv.Itoa(d.Column),
+	)
+	args := make([]string, len(tmpl))
+	for i, arg := range tmpl {
+		args[i] = r.Replace(arg)
+	}
+
+	c := exec.Command(args[0], args[1:]...)
+	if err := c.Start(); err != nil {
+		return err
+	}
+	go c.Wait()
+	return nil
+}
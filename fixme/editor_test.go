@@ -0,0 +1,41 @@
+package fixme
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEditorCommand(t *testing.T) {
+	visual, editor := os.Getenv("VISUAL"), os.Getenv("EDITOR")
+	path := os.Getenv("PATH")
+	defer func() {
+		os.Setenv("VISUAL", visual)
+		os.Setenv("EDITOR", editor)
+		os.Setenv("PATH", path)
+	}()
+	// nothing is installed, so terminal editors have no graphical version
+	os.Setenv("PATH", "")
+
+	tests := []struct {
+		cmd, visual, editor string
+		want                string
+		err                 bool
+	}{
+		{cmd: "myeditor {file}", visual: "vim", want: "myeditor {file}"},
+		{visual: "code", editor: "vim", want: editorTemplates["code"]},
+		{visual: "/usr/local/bin/subl", want: editorTemplates["subl"]},
+		{editor: "kate", want: "kate {file}"},
+		{visual: "nano", editor: "code", want: editorTemplates["code"]},
+		{visual: "vim", err: true},
+		{visual: " ", err: true},
+		{err: true},
+	}
+	for _, tt := range tests {
+		os.Setenv("VISUAL", tt.visual)
+		os.Setenv("EDITOR", tt.editor)
+		got, err := EditorCommand(tt.cmd)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("cmd %q, VISUAL %q, EDITOR %q: got %q, %v", tt.cmd, tt.visual, tt.editor, got, err)
+		}
+	}
+}
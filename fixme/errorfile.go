@@ -0,0 +1,57 @@
+package fixme
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrorFile is where projects write their current failure when a run
+// finishes, with ErrorFileAll passed to WriteErrorFile. Nothing is written if
+// it's empty.
+var (
+	ErrorFile    string
+	ErrorFileAll bool
+)
+
+// WriteErrorFile writes the diagnostics of pkg to path, one per line in the
+// "file:line:col: message" format read by vim's :cfile and Emacs
+// compilation-mode. If all is false, only the first diagnostic is written. A
+// failure without diagnostics writes the first line of its output. A nil pkg,
+// meaning nothing is failing, empties the file. The file is replaced
+// atomically so editors never read half of it.
+func WriteErrorFile(path string, pkg *Package, all bool) error {
+	var buf bytes.Buffer
+	if pkg != nil {
+		ds := pkg.Diagnostics
+		if !all && len(ds) > 1 {
+			ds = ds[:1]
+		}
+		for _, d := range ds {
+			d.Message = strings.Replace(d.Message, "\n", "; ", -1)
+			buf.WriteString(d.String())
+			buf.WriteByte('\n')
+		}
+		if len(ds) == 0 {
+			line := strings.SplitN(strings.TrimSpace(pkg.Data), "\n", 2)[0]
+			buf.WriteString(pkg.Import + ": " + pkg.State().String() + ": " + line + "\n")
+		}
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".fixme-errors")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(buf.Bytes()); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
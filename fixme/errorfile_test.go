@@ -0,0 +1,56 @@
+package fixme
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteErrorFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "errors")
+
+	failing := &Package{
+		Import: "example.com/m/a",
+		state:  failBuild,
+		Data:   "# example.com/m/a\n./a.go:3:9: undefined: x\n",
+		Diagnostics: []Diagnostic{
+			{File: "/src/a.go", Line: 3, Column: 9, Message: "undefined: x\nhave y"},
+			{File: "/src/b.go", Line: 1, Message: "second"},
+		},
+	}
+	noDiagnostics := &Package{
+		Import: "example.com/m/b",
+		state:  failTest,
+		Data:   "\npanic: boom\ngoroutine 1\n",
+	}
+
+	tests := []struct {
+		name string
+		pkg  *Package
+		all  bool
+		want string
+	}{
+		{"first", failing, false, "/src/a.go:3:9: undefined: x; have y\n"},
+		{"all", failing, true, "/src/a.go:3:9: undefined: x; have y\n/src/b.go:1: second\n"},
+		{"no diagnostics", noDiagnostics, false, "example.com/m/b: Test: panic: boom\n"},
+		{"passing", nil, false, ""},
+	}
+	for _, tt := range tests {
+		if err := WriteErrorFile(path, tt.pkg, tt.all); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
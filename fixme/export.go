@@ -0,0 +1,197 @@
+package fixme
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"path/filepath"
+	"strings"
+)
+
+// exportVersion is the version of the export format. Files from a newer
+// version are refused rather than imported wrong.
+const exportVersion = 1
+
+// exportFile is a project as it's shared between people. Packages are found
+// by import path when the file is imported, if that fails their path is used.
+// Paths under the directory the file is in are written relative to it, so a
+// file kept in a repo works wherever the repo is checked out.
+type exportFile struct {
+	Version  int             `json:"version" yaml:"version"`
+	Name     string          `json:"name" yaml:"name"`
+	Packages []exportPackage `json:"packages" yaml:"packages"`
+	Patterns []exportPattern `json:"patterns,omitempty" yaml:"patterns,omitempty"`
+}
+
+type exportPackage struct {
+	Import string `json:"import" yaml:"import"`
+	Action string `json:"action" yaml:"action"`
+	Path   string `json:"path,omitempty" yaml:"path,omitempty"`
+}
+
+type exportPattern struct {
+	Pattern string   `json:"pattern" yaml:"pattern"`
+	Action  string   `json:"action" yaml:"action"`
+	Auto    bool     `json:"auto,omitempty" yaml:"auto,omitempty"`
+	Exclude []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+}
+
+// ExportFormat picks the format for a file by its extension, "yaml" for .yaml
+// and .yml, otherwise "json".
+func ExportFormat(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return "json"
+}
+
+// Export writes the project in a format, "json" or "yaml", that can be
+// shared and read back with Import. The dir is where the file will be written,
+// if it's empty all paths are absolute.
+func Export(pr ProjectRecord, format string, dir string) ([]byte, error) {
+	f := exportFile{
+		Version:  exportVersion,
+		Name:     pr.Name,
+		Packages: make([]exportPackage, len(pr.Pkgs)),
+	}
+	for i, pkg := range pr.Pkgs {
+		f.Packages[i] = exportPackage{
+			Import: pkg.Import,
+			Action: pkg.Action.String(),
+			Path:   pkg.Path,
+		}
+		if dir == "" || pkg.Path == "" {
+			continue
+		}
+		if rel, err := filepath.Rel(dir, pkg.Path); err == nil && !strings.HasPrefix(rel, "..") {
+			f.Packages[i].Path = filepath.ToSlash(rel)
+		}
+	}
+	for _, pt := range pr.Patterns {
+		f.Patterns = append(f.Patterns, exportPattern{
+			Pattern: pt.Pattern,
+			Action:  pt.Action.String(),
+			Auto:    pt.Auto,
+			Exclude: pt.Exclude,
+		})
+	}
+
+	if format == "yaml" {
+		return yaml.Marshal(f)
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	return append(data, '\n'), err
+}
+
+// Import creates and saves a new project from a file written by Export,
+// relative paths are taken to be under dir. If dir is empty, packages with
+// relative paths can only be found by import path and relative patterns are
+// left out. The import paths of packages that couldn't be found and the
+// patterns left out are returned as missing, the rest of the project is still
+// imported.
+func Import(data []byte, format string, dir string) (p *Project, missing []string, err error) {
+	var f exportFile
+	if format == "yaml" {
+		err = yaml.Unmarshal(data, &f)
+	} else {
+		err = json.Unmarshal(data, &f)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.Version > exportVersion {
+		return nil, nil, fmt.Errorf("project file is version %d, this fixme only reads up to version %d", f.Version, exportVersion)
+	}
+
+	pkgs, err := parsePackages(f.Packages, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	patterns, skipped, err := parsePatterns(f.Patterns, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p = NewProject()
+	p.do(func() {
+		if f.Name != "" {
+			p.name = f.Name
+		}
+		missing = append(p.trackRecords(pkgs), skipped...)
+		p.patterns = patterns
+	})
+	if err := p.Save(); err != nil {
+		p.Close()
+		return nil, missing, err
+	}
+	return p, missing, nil
+}
+
+// parsePackages converts packages from a file, relative paths are taken to be
+// under dir. If dir is empty they're dropped rather than taken to be under the
+// working directory.
+func parsePackages(pkgs []exportPackage, dir string) ([]PackageRecord, error) {
+	var recs []PackageRecord
+	for _, pkg := range pkgs {
+		action, ok := ParseAction(pkg.Action)
+		if !ok {
+			return nil, fmt.Errorf("unknown action %q for %s", pkg.Action, pkg.Import)
+		}
+		path := filepath.FromSlash(pkg.Path)
+		if path != "" && !filepath.IsAbs(path) {
+			if dir == "" {
+				path = ""
+			} else {
+				path = filepath.Join(dir, path)
+			}
+		}
+		recs = append(recs, PackageRecord{
+			Import: pkg.Import,
+			Path:   path,
+			Action: action,
+		})
+	}
+	return recs, nil
+}
+
+// parsePatterns converts patterns from a file. Patterns starting with "./" are
+// taken to be under dir, if dir is empty they're returned as skipped.
+func parsePatterns(pts []exportPattern, dir string) (patterns []Pattern, skipped []string, err error) {
+	for _, pt := range pts {
+		action, ok := ParseAction(pt.Action)
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown action %q for pattern %s", pt.Action, pt.Pattern)
+		}
+		pattern := pt.Pattern
+		if pattern == "." || strings.HasPrefix(pattern, "./") {
+			if dir == "" {
+				skipped = append(skipped, pattern)
+				continue
+			}
+			pattern = filepath.Join(dir, pattern)
+		}
+		patterns = append(patterns, Pattern{
+			Pattern: pattern,
+			Action:  action,
+			Auto:    pt.Auto,
+			Exclude: pt.Exclude,
+		})
+	}
+	return patterns, skipped, nil
+}
+
+// trackRecords adds the packages to the project and returns the import paths
+// of the ones that couldn't be found.
+func (p *Project) trackRecords(recs []PackageRecord) []string {
+	var missing []string
+	for _, rec := range recs {
+		pkg := rec.Package()
+		if pkg == nil {
+			missing = append(missing, rec.Import)
+			continue
+		}
+		p.track(pkg)
+	}
+	return missing
+}
@@ -0,0 +1,187 @@
+package fixme
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParsePackages(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  string
+		pkgs []exportPackage
+		want []PackageRecord
+		ok   bool
+	}{
+		{
+			name: "relative and absolute paths",
+			dir:  "/src",
+			pkgs: []exportPackage{
+				{Import: "example.com/a", Action: "test", Path: "a"},
+				{Import: "example.com/b", Action: "lint", Path: "/other/b"},
+				{Import: "example.com/c", Action: "watch"},
+			},
+			want: []PackageRecord{
+				{Import: "example.com/a", Action: Test, Path: filepath.FromSlash("/src/a")},
+				{Import: "example.com/b", Action: Lint, Path: filepath.FromSlash("/other/b")},
+				{Import: "example.com/c", Action: Watch},
+			},
+			ok: true,
+		},
+		{
+			name: "relative path without a dir",
+			dir:  "",
+			pkgs: []exportPackage{{Import: "example.com/a", Action: "test", Path: "a"}},
+			want: []PackageRecord{{Import: "example.com/a", Action: Test}},
+			ok:   true,
+		},
+		{
+			name: "unknown action",
+			pkgs: []exportPackage{{Import: "example.com/a", Action: "bench"}},
+		},
+		{
+			name: "missing action",
+			pkgs: []exportPackage{{Import: "example.com/a"}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parsePackages(tt.pkgs, filepath.FromSlash(tt.dir))
+		if (err == nil) != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, %v", tt.name, got, err)
+		}
+	}
+}
+
+func TestParsePatterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		dir     string
+		pts     []exportPattern
+		want    []Pattern
+		skipped []string
+		ok      bool
+	}{
+		{
+			name: "relative to dir",
+			dir:  "/src",
+			pts: []exportPattern{
+				{Pattern: "./...", Action: "test", Auto: true, Exclude: []string{"example.com/x"}},
+				{Pattern: ".", Action: "lint"},
+				{Pattern: "example.com/...", Action: "watch"},
+			},
+			want: []Pattern{
+				{Pattern: filepath.FromSlash("/src/..."), Action: Test, Auto: true, Exclude: []string{"example.com/x"}},
+				{Pattern: filepath.FromSlash("/src"), Action: Lint},
+				{Pattern: "example.com/...", Action: Watch},
+			},
+			ok: true,
+		},
+		{
+			name: "no dir",
+			pts: []exportPattern{
+				{Pattern: "./...", Action: "test"},
+				{Pattern: ".", Action: "lint"},
+				{Pattern: "example.com/...", Action: "watch"},
+			},
+			want:    []Pattern{{Pattern: "example.com/...", Action: Watch}},
+			skipped: []string{"./...", "."},
+			ok:      true,
+		},
+		{
+			name: "unknown action",
+			dir:  "/src",
+			pts:  []exportPattern{{Pattern: "./...", Action: "tests"}},
+		},
+	}
+	for _, tt := range tests {
+		got, skipped, err := parsePatterns(tt.pts, filepath.FromSlash(tt.dir))
+		if (err == nil) != tt.ok || !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(skipped, tt.skipped) {
+			t.Errorf("%s: got %+v, skipped %q, %v", tt.name, got, skipped, err)
+		}
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module example.com/export\n",
+		"a/a.go": "package a\n",
+		"b/b.go": "package b\n",
+	})
+	defer os.RemoveAll(dir)
+	pr := ProjectRecord{
+		Name: "shared",
+		Pkgs: []PackageRecord{
+			{Import: "example.com/export/a", Action: Test, Path: filepath.Join(dir, "a")},
+			{Import: "example.com/export/b", Action: Lint, Path: filepath.Join(dir, "b")},
+			{Import: "example.com/export/gone", Action: Test, Path: filepath.Join(dir, "gone")},
+		},
+		Patterns: []Pattern{{Pattern: "example.com/export/...", Action: Watch, Auto: true}},
+	}
+
+	for _, format := range []string{"json", "yaml"} {
+		data, err := Export(pr, format, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the paths are relative so the file works in another checkout
+		if bytes.Contains(data, []byte(dir)) {
+			t.Errorf("%s: %s has absolute paths", format, data)
+		}
+		p, missing, err := Import(data, format, dir)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		got := p.ProjectRecord()
+		p.Close()
+		sort.Slice(got.Pkgs, func(i, j int) bool {
+			return got.Pkgs[i].Import < got.Pkgs[j].Import
+		})
+		if got.Name != pr.Name || !reflect.DeepEqual(got.Pkgs, pr.Pkgs[:2]) || !reflect.DeepEqual(got.Patterns, pr.Patterns) {
+			t.Errorf("%s: got %+v", format, got)
+		}
+		if !reflect.DeepEqual(missing, []string{"example.com/export/gone"}) {
+			t.Errorf("%s: got missing %q", format, missing)
+		}
+	}
+
+	if _, _, err := Import([]byte(`{"version": 2, "name": "new"}`), "json", dir); err == nil {
+		t.Error("imported a file from a newer version")
+	}
+}
+
+func TestImportWithoutDir(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module example.com/nodir\n",
+		"a/a.go": "package a\n",
+	})
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// relative entries mustn't be found under the working directory
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	data := []byte(`{"version": 1, "name": "nodir",
+		"packages": [{"import": "example.com/nodir/a", "action": "test", "path": "a"}],
+		"patterns": [{"pattern": "./...", "action": "watch"}]}`)
+	p, missing, err := Import(data, "json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := p.ProjectRecord()
+	p.Close()
+	if len(got.Pkgs) != 0 || len(got.Patterns) != 0 {
+		t.Errorf("got %+v", got)
+	}
+	if !reflect.DeepEqual(missing, []string{"example.com/nodir/a", "./..."}) {
+		t.Errorf("got missing %q", missing)
+	}
+}
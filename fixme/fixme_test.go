@@ -0,0 +1,52 @@
+package fixme
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// keep the tests away from the user's projects and GOPATH
+	dir, err := ioutil.TempDir("", "fixme")
+	if err != nil {
+		panic(err)
+	}
+	build.Default.GOPATH = dir
+	SetStore(NewMemoryStore())
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// writeTree creates a temporary directory with the files, keyed by their
+// slash separated path. Directories are created as needed, a name ending in
+// "/" is an empty directory.
+func writeTree(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "fixme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the index and patterns work with the real path
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if name[len(name)-1] == '/' {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
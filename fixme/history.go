@@ -0,0 +1,193 @@
+package fixme
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RunRecord is the outcome of one run of a project, kept so it can still be
+// looked at after newer runs replace it. State is "OK" or the step that
+// failed, "Build", "Test" or "Lint", and Output and Diagnostics are those of
+// the package that failed. The ID is a string in JSON, JavaScript can't hold
+// it as a number.
+type RunRecord struct {
+	ID          uint64 `json:",string"`
+	Start       time.Time
+	Trigger     string
+	Only        string
+	Duration    time.Duration
+	State       string
+	Failed      string
+	Steps       []StepRecord
+	Output      string
+	Diagnostics []Diagnostic
+}
+
+// StepRecord is how one step of a run went for one package.
+type StepRecord struct {
+	Package  string
+	Step     string
+	Failed   bool
+	Duration time.Duration
+}
+
+// summary is the record without its output, for listing runs.
+func (r RunRecord) summary() RunRecord {
+	r.Steps = nil
+	r.Output = ""
+	r.Diagnostics = nil
+	return r
+}
+
+// Retention limits the history kept for each project. When a run is added,
+// runs beyond the newest Runs or older than Age are deleted. Zero doesn't
+// limit.
+type Retention struct {
+	Runs int
+	Age  time.Duration
+}
+
+// HistoryRetention is the Retention used for every project.
+var HistoryRetention = Retention{
+	Runs: 100,
+	Age:  30 * 24 * time.Hour,
+}
+
+// historyStore is implemented by stores that keep the history of runs. Runs
+// are listed newest first, without their output. A project's history is
+// deleted with it.
+type historyStore interface {
+	saveRun(project []byte, rec *RunRecord, keep Retention) error
+	runs(project []byte, limit int) ([]RunRecord, error)
+	run(project []byte, id uint64) (RunRecord, error)
+}
+
+// ErrNoHistory is returned when the store projects are kept in doesn't keep the
+// history of runs.
+var ErrNoHistory = errors.New("the project store doesn't keep run history")
+
+// ErrRunNotFound is returned when a run isn't in the history, usually because
+// it's past the retention limit.
+var ErrRunNotFound = errors.New("run not found")
+
+// runID makes the ID of a run started at t, after the newest run last.
+// IDs are the start time so old runs can be found without decoding them.
+func runID(t time.Time, last uint64) uint64 {
+	id := uint64(t.UnixNano())
+	if id <= last {
+		id = last + 1
+	}
+	return id
+}
+
+// expired reports whether the run with id is older than the retention allows.
+func (keep Retention) expired(id uint64, now time.Time) bool {
+	return keep.Age > 0 && int64(id) < now.Add(-keep.Age).UnixNano()
+}
+
+// KeepsHistory reports whether the store projects are kept in keeps the
+// history of runs. A RemoteStore or DirStore doesn't.
+func KeepsHistory() bool {
+	s, err := currentStore()
+	if err != nil {
+		return false
+	}
+	_, ok := s.(historyStore)
+	return ok
+}
+
+func historyOf(s Store) (historyStore, error) {
+	hs, ok := s.(historyStore)
+	if !ok {
+		return nil, ErrNoHistory
+	}
+	return hs, nil
+}
+
+// History returns up to limit of the project's most recent runs, newest first,
+// without their output. Use PastRun to get a run's output.
+func (p *Project) History(limit int) ([]RunRecord, error) {
+	s, err := currentStore()
+	if err != nil {
+		return nil, err
+	}
+	hs, err := historyOf(s)
+	if err != nil {
+		return nil, err
+	}
+	runs, err := hs.runs(p.id, limit)
+	return runs, storeErr("load run history", err)
+}
+
+// PastRun returns the run in the project's history with the given ID.
+func (p *Project) PastRun(id uint64) (RunRecord, error) {
+	s, err := currentStore()
+	if err != nil {
+		return RunRecord{}, err
+	}
+	hs, err := historyOf(s)
+	if err != nil {
+		return RunRecord{}, err
+	}
+	rec, err := hs.run(p.id, id)
+	if err == ErrRunNotFound {
+		return rec, err
+	}
+	return rec, storeErr("load run", err)
+}
+
+// historyBuffer is how many runs can wait to be written to the history.
+const historyBuffer = 16
+
+// pendingRun is a run waiting to be written by writeHistory.
+type pendingRun struct {
+	name string
+	rec  RunRecord
+}
+
+// recordRun adds a finished run to the history, if the store keeps one. The
+// run is written by writeHistory, if it's too far behind the run is dropped.
+func (p *Project) recordRun(res runResult) {
+	if !KeepsHistory() {
+		return
+	}
+	rec := RunRecord{
+		Start:    res.start,
+		Trigger:  res.trigger,
+		Only:     res.only,
+		Duration: res.duration,
+		State:    "OK",
+		Steps:    res.steps,
+	}
+	if res.failed != nil {
+		rec.State = res.failed.state.String()
+		rec.Failed = res.failed.Import
+		rec.Output = res.failed.Data
+		rec.Diagnostics = res.failed.Diagnostics
+	}
+	select {
+	case p.history <- pendingRun{p.name, rec}:
+	default:
+		fmt.Println(p.name, " Error: the run history is behind, a run wasn't saved")
+	}
+}
+
+// writeHistory saves the runs sent on p.history, so a slow store doesn't hold
+// up the project's goroutine. It returns once the project is closed and the
+// runs that were waiting are written.
+func (p *Project) writeHistory() {
+	for run := range p.history {
+		s, err := currentStore()
+		if err != nil {
+			continue
+		}
+		hs, err := historyOf(s)
+		if err != nil {
+			continue
+		}
+		if err := hs.saveRun(p.id, &run.rec, HistoryRetention); err != nil {
+			fmt.Println(run.name, " Error: ", storeErr("save run", err))
+		}
+	}
+}
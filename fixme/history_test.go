@@ -0,0 +1,144 @@
+package fixme
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunID(t *testing.T) {
+	start := time.Unix(100, 0)
+	tests := []struct {
+		name string
+		last uint64
+		want uint64
+	}{
+		{"first run", 0, uint64(start.UnixNano())},
+		{"after an older run", uint64(start.UnixNano()) - 1, uint64(start.UnixNano())},
+		{"same start as the last run", uint64(start.UnixNano()), uint64(start.UnixNano()) + 1},
+		// the clock went back
+		{"after a newer run", uint64(start.UnixNano()) + 50, uint64(start.UnixNano()) + 51},
+	}
+	for _, tt := range tests {
+		if got := runID(start, tt.last); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Unix(1000, 0)
+	id := func(d time.Duration) uint64 {
+		return uint64(now.Add(-d).UnixNano())
+	}
+	tests := []struct {
+		keep Retention
+		id   uint64
+		want bool
+	}{
+		{Retention{Age: time.Minute}, id(2 * time.Minute), true},
+		{Retention{Age: time.Minute}, id(time.Second), false},
+		{Retention{Age: time.Minute}, id(time.Minute), false},
+		// no age limit
+		{Retention{Runs: 1}, id(24 * time.Hour), false},
+	}
+	for _, tt := range tests {
+		if got := tt.keep.expired(tt.id, now); got != tt.want {
+			t.Errorf("%+v expired(%d) = %v, want %v", tt.keep, tt.id, got, tt.want)
+		}
+	}
+}
+
+// testRetention checks the retention of a historyStore that has no runs for
+// the project yet.
+func testRetention(t *testing.T, hs historyStore, project []byte) {
+	now := time.Now()
+	save := func(age time.Duration, keep Retention) uint64 {
+		rec := RunRecord{
+			Start:  now.Add(-age),
+			State:  "Test",
+			Output: "FAIL",
+		}
+		if err := hs.saveRun(project, &rec, keep); err != nil {
+			t.Fatal(err)
+		}
+		return rec.ID
+	}
+
+	var ids []uint64
+	for i := 5; i > 0; i-- {
+		ids = append(ids, save(time.Duration(i)*time.Hour, Retention{}))
+	}
+	runs, err := hs.runs(project, 0)
+	if err != nil || len(runs) != 5 {
+		t.Fatalf("got %d runs, %v, without a limit", len(runs), err)
+	}
+	for i, run := range runs {
+		if run.ID != ids[len(ids)-1-i] {
+			t.Errorf("run %d is %d, want newest first", i, run.ID)
+		}
+		if run.Output != "" {
+			t.Errorf("listed run %d with its output", i)
+		}
+	}
+	if runs, _ := hs.runs(project, 2); len(runs) != 2 || runs[0].ID != ids[4] {
+		t.Errorf("got %+v with a limit of 2", runs)
+	}
+
+	// too old, the 5 hour run goes
+	ids = append(ids, save(0, Retention{Age: 4*time.Hour + 30*time.Minute}))
+	if _, err := hs.run(project, ids[0]); err != ErrRunNotFound {
+		t.Errorf("got %v loading an expired run", err)
+	}
+	// too many, only the newest 3 are kept
+	ids = append(ids, save(0, Retention{Runs: 3}))
+	runs, _ = hs.runs(project, 0)
+	if len(runs) != 3 || runs[0].ID != ids[6] || runs[2].ID != ids[4] {
+		t.Errorf("got %+v keeping 3 runs", runs)
+	}
+	rec, err := hs.run(project, ids[6])
+	if err != nil || rec.Output != "FAIL" {
+		t.Errorf("got %+v, %v", rec, err)
+	}
+}
+
+func TestMemoryStoreRetention(t *testing.T) {
+	testRetention(t, NewMemoryStore(), []byte("p"))
+}
+
+func TestBoltStoreRetention(t *testing.T) {
+	path, done := tempDB(t)
+	defer done()
+	s, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	testRetention(t, s, []byte("p"))
+}
+
+func TestRecordRun(t *testing.T) {
+	p, r, dir, _ := newTestProject(t)
+	r.Set(filepath.Join(dir, "b"), "go test", testFail, nil)
+	p.Rerun()
+	waitRun(t, p)
+
+	// the run is written after the result is sent
+	var runs []RunRecord
+	for wait := time.Now().Add(5 * time.Second); time.Now().Before(wait); time.Sleep(10 * time.Millisecond) {
+		var err error
+		if runs, err = p.History(0); err != nil {
+			t.Fatal(err)
+		}
+		if len(runs) > 0 {
+			break
+		}
+	}
+	if len(runs) != 1 || runs[0].State != "Test" {
+		t.Fatalf("got %+v", runs)
+	}
+	rec, err := p.PastRun(runs[0].ID)
+	if err != nil || rec.Output != testFail || len(rec.Steps) == 0 {
+		t.Errorf("got %+v, %v", rec, err)
+	}
+}
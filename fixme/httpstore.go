@@ -0,0 +1,179 @@
+package fixme
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// StorePath is the path StoreHandler is served on.
+const StorePath = "/store/"
+
+// StoreHandler serves s over HTTP so that another fixme can use it with a
+// RemoteStore while this one has the database open. Projects are at StorePath
+// followed by their ID in hex, a GET of StorePath lists them. Requests have to
+// carry token as a bearer token. After a project is saved or deleted through
+// the handler, changed is called with its ID if it isn't nil.
+func StoreHandler(s Store, token string, changed func(id []byte)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := []byte(r.Header.Get("Authorization"))
+		if token == "" || subtle.ConstantTimeCompare(auth, []byte("Bearer "+token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, StorePath)
+		if key == "" {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			prs, err := s.List()
+			writeStoreResponse(w, prs, err)
+			return
+		}
+		id, err := hex.DecodeString(key)
+		if err != nil {
+			http.Error(w, "bad project id", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			pr, err := s.Load(id)
+			writeStoreResponse(w, pr, err)
+		case http.MethodPut:
+			var pr ProjectRecord
+			if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			pr.ID = id
+			err := s.Save(pr)
+			if err == nil && changed != nil {
+				changed(id)
+			}
+			writeStoreResponse(w, nil, err)
+		case http.MethodDelete:
+			err := s.Delete(id)
+			if err == nil && changed != nil {
+				changed(id)
+			}
+			writeStoreResponse(w, nil, err)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func writeStoreResponse(w http.ResponseWriter, v interface{}, err error) {
+	if err == ErrProjectNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// StoreTokenPath returns where the token for the StoreHandler of the database
+// at dbPath is kept.
+func StoreTokenPath(dbPath string) string {
+	return dbPath + ".token"
+}
+
+// NewStoreToken makes a random token and writes it to path so that only the
+// user can read it.
+func NewStoreToken(path string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	// the mode given to WriteFile is only used if the file is created
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return token, ioutil.WriteFile(path, []byte(token+"\n"), 0600)
+}
+
+// ReadStoreToken reads a token written by NewStoreToken.
+func ReadStoreToken(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	return strings.TrimSpace(string(data)), err
+}
+
+// RemoteStore is a Store that uses the StoreHandler of the fixme running at
+// Addr, "host:port", sending Token with each request.
+type RemoteStore struct {
+	Addr  string
+	Token string
+}
+
+func (s *RemoteStore) url(id []byte) string {
+	return "http://" + s.Addr + StorePath + hex.EncodeToString(id)
+}
+
+func (s *RemoteStore) Save(pr ProjectRecord) error {
+	data, err := json.Marshal(pr)
+	if err != nil {
+		return err
+	}
+	return s.do(http.MethodPut, s.url(pr.ID), data, nil)
+}
+
+func (s *RemoteStore) Load(id []byte) (ProjectRecord, error) {
+	var pr ProjectRecord
+	err := s.do(http.MethodGet, s.url(id), nil, &pr)
+	pr.ID = id
+	return pr, err
+}
+
+func (s *RemoteStore) Delete(id []byte) error {
+	return s.do(http.MethodDelete, s.url(id), nil, nil)
+}
+
+func (s *RemoteStore) List() ([]ProjectRecord, error) {
+	var prs []ProjectRecord
+	err := s.do(http.MethodGet, s.url(nil), nil, &prs)
+	return prs, err
+}
+
+func (s *RemoteStore) Close() error {
+	return nil
+}
+
+// do sends a request and decodes the response into v if it isn't nil.
+func (s *RemoteStore) do(method, url string, body []byte, v interface{}) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrProjectNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(strings.TrimSpace(string(msg)))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
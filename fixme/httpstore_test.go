@@ -0,0 +1,92 @@
+package fixme
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStoreHandler(t *testing.T) {
+	var changed [][]byte
+	srv := httptest.NewServer(StoreHandler(NewMemoryStore(), "secret", func(id []byte) {
+		changed = append(changed, id)
+	}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	pr := ProjectRecord{
+		Name: "p",
+		ID:   []byte("id"),
+		Pkgs: []PackageRecord{{Import: "example.com/a", Action: Test}},
+	}
+	for _, token := range []string{"", "wrong"} {
+		s := &RemoteStore{Addr: addr, Token: token}
+		if err := s.Save(pr); err == nil {
+			t.Errorf("saved with token %q", token)
+		}
+		if _, err := s.List(); err == nil {
+			t.Errorf("listed with token %q", token)
+		}
+	}
+	if len(changed) != 0 {
+		t.Errorf("changed called for %q without the token", changed)
+	}
+
+	s := &RemoteStore{Addr: addr, Token: "secret"}
+	if err := s.Save(pr); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Load(pr.ID)
+	if err != nil || !reflect.DeepEqual(got, pr) {
+		t.Errorf("got %+v, %v", got, err)
+	}
+	if err := s.Delete(pr.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load(pr.ID); err != ErrProjectNotFound {
+		t.Errorf("got %v loading a deleted project", err)
+	}
+	if want := [][]byte{pr.ID, pr.ID}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed called for %q, want %q", changed, want)
+	}
+}
+
+func TestStoreHandlerNoToken(t *testing.T) {
+	srv := httptest.NewServer(StoreHandler(NewMemoryStore(), "", nil))
+	defer srv.Close()
+	s := &RemoteStore{Addr: strings.TrimPrefix(srv.URL, "http://")}
+	if _, err := s.List(); err == nil {
+		t.Error("a handler without a token allowed a request")
+	}
+}
+
+func TestStoreToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := StoreTokenPath(filepath.Join(dir, "projects.db"))
+	// a token left from before with the wrong mode is replaced
+	if err := ioutil.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := NewStoreToken(path)
+	if err != nil || len(token) != 64 {
+		t.Fatalf("got %q, %v", token, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("token file is %v, %v", info.Mode(), err)
+	}
+	if got, err := ReadStoreToken(path); err != nil || got != token {
+		t.Errorf("read %q, %v, want %q", got, err, token)
+	}
+	if again, _ := NewStoreToken(path); again == token {
+		t.Error("got the same token twice")
+	}
+}
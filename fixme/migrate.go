@@ -0,0 +1,142 @@
+package fixme
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"github.com/adamcolton/gothic/bufpool"
+	"github.com/boltdb/bolt"
+	"strconv"
+)
+
+// migration upgrades every record in the database from the version before it
+// to its own version. Migrations decode old records with their own types, so
+// they keep working as the current types change.
+type migration func(tx *bolt.Tx) error
+
+// migrations are run in order when a database is opened. Version n of the
+// database has had the first n migrations run; a new database starts at
+// schemaVersion. Add to the end, never change one that has been released.
+var migrations = []migration{
+	// 1: store actions by name
+	migrateActionNames,
+}
+
+var schemaVersion = len(migrations)
+
+var versionKey = []byte("schema")
+
+// ErrNewerSchema is returned when the database was written by a newer fixme,
+// rather than risk reading or writing records in a format it doesn't know.
+var ErrNewerSchema = errors.New("the project database was written by a newer fixme")
+
+// migrate brings the database up to schemaVersion in one transaction, so a
+// failed migration leaves it as it was.
+func migrate(tx *bolt.Tx) error {
+	settings := tx.Bucket(settingsBucket)
+	version := 0
+	if v := settings.Get(versionKey); v != nil {
+		var err error
+		if version, err = strconv.Atoi(string(v)); err != nil {
+			return err
+		}
+	} else if k, _ := tx.Bucket(projectsBucket).Cursor().First(); k == nil {
+		// nothing has been written, so there's nothing to migrate
+		version = schemaVersion
+	}
+	if version > schemaVersion {
+		return ErrNewerSchema
+	}
+	for ; version < schemaVersion; version++ {
+		if err := migrations[version](tx); err != nil {
+			return err
+		}
+	}
+	return settings.Put(versionKey, []byte(strconv.Itoa(version)))
+}
+
+// updateProjects replaces every project record with the result of fn.
+func updateProjects(tx *bolt.Tx, fn func(data []byte) ([]byte, error)) error {
+	bkt := tx.Bucket(projectsBucket)
+	// collect first, changing the bucket invalidates the cursor
+	updated := make(map[string][]byte)
+	c := bkt.Cursor()
+	for id, data := c.First(); id != nil; id, data = c.Next() {
+		out, err := fn(data)
+		if err != nil {
+			return err
+		}
+		updated[string(id)] = out
+	}
+	for id, data := range updated {
+		if err := bkt.Put([]byte(id), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v0Project is a project as it was stored before the schema was versioned,
+// with actions stored by their number. Action was a byte, so the numbers are
+// read into unsigned fields; gob won't decode them into signed ones.
+type v0Project struct {
+	Name     string
+	Pkgs     []v0Package
+	Patterns []v0Pattern
+}
+
+type v0Package struct {
+	Import string
+	Path   string
+	Action uint8
+}
+
+type v0Pattern struct {
+	Pattern string
+	Action  uint8
+	Auto    bool
+	Exclude []string
+}
+
+var v0Actions = []string{"none", "watch", "test", "lint"}
+
+func v0Action(a uint8) string {
+	if int(a) >= len(v0Actions) {
+		return v0Actions[0]
+	}
+	return v0Actions[a]
+}
+
+func migrateActionNames(tx *bolt.Tx) error {
+	return updateProjects(tx, func(data []byte) ([]byte, error) {
+		var old v0Project
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&old); err != nil {
+			return nil, err
+		}
+		sp := storedProject{
+			Version: 1,
+			Name:    old.Name,
+		}
+		for _, pkg := range old.Pkgs {
+			sp.Pkgs = append(sp.Pkgs, storedPackage{
+				Import: pkg.Import,
+				Path:   pkg.Path,
+				Action: v0Action(pkg.Action),
+			})
+		}
+		for _, pt := range old.Patterns {
+			sp.Patterns = append(sp.Patterns, storedPattern{
+				Pattern: pt.Pattern,
+				Action:  v0Action(pt.Action),
+				Auto:    pt.Auto,
+				Exclude: pt.Exclude,
+			})
+		}
+		buf := bufpool.Get()
+		if err := gob.NewEncoder(buf).Encode(sp); err != nil {
+			bufpool.Put(buf)
+			return nil, err
+		}
+		return bufpool.PutAndCopy(buf), nil
+	})
+}
@@ -0,0 +1,170 @@
+package fixme
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/boltdb/bolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// baselineProject is how the first fixme encoded projects, before there was
+// a schema version.
+type baselineProject struct {
+	Name string
+	ID   []byte
+	Pkgs []baselinePackage
+}
+
+type baselinePackage struct {
+	Import string
+	Action Action
+}
+
+// writeBaseline creates a database at path laid out like the first fixme's,
+// with the projects keyed by their ID.
+func writeBaseline(t *testing.T, path string, projects map[string]baselineProject) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucket(projectsBucket)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucket(settingsBucket); err != nil {
+			return err
+		}
+		for id, pr := range projects {
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(pr); err != nil {
+				return err
+			}
+			if err := bkt.Put([]byte(id), buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tempDB(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "fixme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "projects.db"), func() { os.RemoveAll(dir) }
+}
+
+func TestMigrateBaseline(t *testing.T) {
+	path, done := tempDB(t)
+	defer done()
+	writeBaseline(t, path, map[string]baselineProject{
+		"a": {
+			Name: "first",
+			Pkgs: []baselinePackage{
+				{Import: "example.com/none", Action: None},
+				{Import: "example.com/watch", Action: Watch},
+				{Import: "example.com/test", Action: Test},
+				{Import: "example.com/lint", Action: Lint},
+			},
+		},
+		"b": {Name: "empty"},
+	})
+
+	s, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	prs, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ProjectRecord{
+		{
+			Name: "first",
+			ID:   []byte("a"),
+			Pkgs: []PackageRecord{
+				{Import: "example.com/none", Action: None},
+				{Import: "example.com/watch", Action: Watch},
+				{Import: "example.com/test", Action: Test},
+				{Import: "example.com/lint", Action: Lint},
+			},
+		},
+		{Name: "empty", ID: []byte("b")},
+	}
+	if !reflect.DeepEqual(prs, want) {
+		t.Errorf("got %+v, want %+v", prs, want)
+	}
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		if v := string(tx.Bucket(settingsBucket).Get(versionKey)); v != strconv.Itoa(schemaVersion) {
+			t.Errorf("schema is %q after migrating", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateNewerSchema(t *testing.T) {
+	path, done := tempDB(t)
+	defer done()
+	writeBaseline(t, path, nil)
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(settingsBucket).Put(versionKey, []byte(strconv.Itoa(schemaVersion+1)))
+	})
+	db.Close()
+
+	if s, err := OpenBoltStore(path); err != ErrNewerSchema {
+		if err == nil {
+			s.Close()
+		}
+		t.Errorf("got %v opening a newer database", err)
+	}
+}
+
+func TestStoredProjectVersion(t *testing.T) {
+	tests := []struct {
+		version int
+		err     error
+	}{
+		// a DirStore file from before the version was written
+		{0, nil},
+		{1, nil},
+		{storedVersion, nil},
+		{storedVersion + 1, ErrNewerProject},
+	}
+	for _, tt := range tests {
+		sp := storedProject{
+			Version: tt.version,
+			Name:    "p",
+			Pkgs:    []storedPackage{{Import: "example.com/a", Action: "test"}},
+		}
+		pr, err := sp.record([]byte("id"))
+		if err != tt.err {
+			t.Errorf("version %d: got %v, want %v", tt.version, err, tt.err)
+		}
+		if err == nil && (pr.Name != "p" || len(pr.Pkgs) != 1 || pr.Pkgs[0].Action != Test) {
+			t.Errorf("version %d: got %+v", tt.version, pr)
+		}
+	}
+	if v := toStored(ProjectRecord{}).Version; v != storedVersion {
+		t.Errorf("wrote version %d, want %d", v, storedVersion)
+	}
+}
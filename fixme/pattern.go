@@ -0,0 +1,217 @@
+package fixme
+
+import (
+	"bufio"
+	"errors"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Pattern selects a set of packages to add to a project. The Pattern string
+// can be an import path, an import path ending in "/..." to select a whole
+// subtree or a directory on disk. A directory that is a module root (contains
+// a go.mod) selects every package in the module. If Auto is set, the project
+// keeps the pattern and adds packages that appear under it later.
+type Pattern struct {
+	Pattern string
+	Action  Action
+	Auto    bool
+	Exclude []string
+}
+
+// Packages returns every package the pattern currently matches.
+func (pt Pattern) Packages() []*Package {
+	dir, imp, recursive := pt.root()
+	if dir == "" {
+		return nil
+	}
+	if !recursive {
+		if !hasGoFiles(dir) || pt.excluded(imp) {
+			return nil
+		}
+		return []*Package{packageAt(dir, imp)}
+	}
+
+	var pkgs []*Package
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if path != dir && skipDir(path, info) {
+			return filepath.SkipDir
+		}
+		if !hasGoFiles(path) {
+			return nil
+		}
+		i := imp
+		if rel, _ := filepath.Rel(dir, path); rel != "." {
+			i = imp + "/" + filepath.ToSlash(rel)
+		}
+		if !pt.excluded(i) {
+			pkgs = append(pkgs, packageAt(path, i))
+		}
+		return nil
+	})
+	return pkgs
+}
+
+// Dirs returns every directory under the pattern's root, these need to be
+// watched to notice new packages.
+func (pt Pattern) Dirs() []string {
+	dir, _, recursive := pt.root()
+	if dir == "" {
+		return nil
+	}
+	if !recursive {
+		return []string{dir}
+	}
+	var dirs []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if path != dir && skipDir(path, info) {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, path)
+		return nil
+	})
+	return dirs
+}
+
+// Match reports whether the pattern selects the package.
+func (pt Pattern) Match(pkg *Package) bool {
+	_, imp, recursive := pt.root()
+	if imp == "" || pt.excluded(pkg.Import) {
+		return false
+	}
+	if pkg.Import == imp {
+		return true
+	}
+	return recursive && strings.HasPrefix(pkg.Import, imp+"/")
+}
+
+func (pt Pattern) excluded(imp string) bool {
+	for _, e := range pt.Exclude {
+		if e == imp {
+			return true
+		}
+	}
+	return false
+}
+
+// root resolves the pattern to a directory, the import path of that
+// directory and whether the packages below it are included.
+func (pt Pattern) root() (dir, imp string, recursive bool) {
+	s := pt.Pattern
+	if strings.HasSuffix(s, "/...") {
+		s, recursive = strings.TrimSuffix(s, "/..."), true
+	}
+
+	if isFilePath(s) {
+		dir, err := filepath.Abs(s)
+		if err != nil {
+			return "", "", false
+		}
+		if imp = importForDir(dir); imp == "" {
+			return "", "", false
+		}
+		if !recursive {
+			_, err = os.Stat(filepath.Join(dir, "go.mod"))
+			recursive = err == nil
+		}
+		return dir, imp, recursive
+	}
+
+	if pkg := PackageByImport(s); pkg != nil {
+		return pkg.Path, s, recursive
+	}
+	bp, err := build.Default.Import(s, "", build.FindOnly)
+	if err != nil {
+		return "", "", false
+	}
+	return bp.Dir, s, recursive
+}
+
+func isFilePath(s string) bool {
+	return filepath.IsAbs(s) || s == "." || s == ".." ||
+		strings.HasPrefix(s, "./") || strings.HasPrefix(s, "../")
+}
+
+// skipDir reports whether a directory found while walking a pattern should be
+// skipped. Nested modules are skipped along with directories the go tool
+// ignores.
+func skipDir(path string, info os.FileInfo) bool {
+	name := info.Name()
+	if name[0] == '.' || name[0] == '_' || name == "testdata" || name == "vendor" {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(path, "go.mod"))
+	return err == nil
+}
+
+func hasGoFiles(dir string) bool {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	return len(files) > 0
+}
+
+// importForDir finds the import path for a directory, either from the GOPATH
+// it's in or from the module that contains it.
+func importForDir(dir string) string {
+	if root, mod, err := ModuleRoot(dir); err == nil {
+		rel, _ := filepath.Rel(root, dir)
+		if rel == "." {
+			return mod
+		}
+		return mod + "/" + filepath.ToSlash(rel)
+	}
+	for _, src := range build.Default.SrcDirs() {
+		rel, err := filepath.Rel(src, dir)
+		if err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return ""
+}
+
+// ErrNoModule is returned by ModuleRoot when no go.mod is found.
+var ErrNoModule = errors.New("no go.mod found")
+
+// ModuleRoot searches dir and its parents for a go.mod. It returns the
+// directory holding the go.mod and the module path declared in it.
+func ModuleRoot(dir string) (root, modPath string, err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	for {
+		f, err := os.Open(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			modPath = readModulePath(f)
+			f.Close()
+			if modPath == "" {
+				return "", "", errors.New("no module line in " + filepath.Join(dir, "go.mod"))
+			}
+			return dir, modPath, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", ErrNoModule
+		}
+		dir = parent
+	}
+}
+
+func readModulePath(f *os.File) string {
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "module") {
+			mod := strings.TrimSpace(strings.TrimPrefix(line, "module"))
+			return strings.Trim(mod, `"`)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+package fixme
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseAction(t *testing.T) {
+	for a := range actionStrs {
+		got, ok := ParseAction(a.String())
+		if !ok || got != a {
+			t.Errorf("ParseAction(%q) = %v, %v", a.String(), got, ok)
+		}
+	}
+	for _, s := range []string{"", "Test", "tests", "2"} {
+		if got, ok := ParseAction(s); ok || got != None {
+			t.Errorf("ParseAction(%q) = %v, %v, want none, false", s, got, ok)
+		}
+	}
+}
+
+func TestPatternPackages(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"go.mod":           "module example.com/m\n",
+		"m.go":             "package m\n",
+		"a/a.go":           "package a\n",
+		"a/b/b.go":         "package b\n",
+		"empty/":           "",
+		".hidden/h.go":     "package h\n",
+		"_skip/s.go":       "package s\n",
+		"a/testdata/t.go":  "package t\n",
+		"vendor/v/v.go":    "package v\n",
+		"nested/go.mod":    "module example.com/nested\n",
+		"nested/n.go":      "package n\n",
+		"excluded/e.go":    "package e\n",
+		"excluded/x/x.go":  "package x\n",
+		"notgo/readme.txt": "",
+	})
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		// a module root selects the whole module
+		{dir, []string{"example.com/m", "example.com/m/a", "example.com/m/a/b", "example.com/m/excluded/x"}},
+		{filepath.Join(dir, "a") + "/...", []string{"example.com/m/a", "example.com/m/a/b"}},
+		{filepath.Join(dir, "a"), []string{"example.com/m/a"}},
+		{filepath.Join(dir, "empty"), nil},
+		{filepath.Join(dir, "excluded"), nil},
+	}
+	for _, tt := range tests {
+		pt := Pattern{
+			Pattern: tt.pattern,
+			Exclude: []string{"example.com/m/excluded"},
+		}
+		var got []string
+		for _, pkg := range pt.Packages() {
+			got = append(got, pkg.Import)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestPatternMatch(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"go.mod":   "module example.com/m\n",
+		"a/a.go":   "package a\n",
+		"a/b/b.go": "package b\n",
+	})
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		pattern string
+		imp     string
+		want    bool
+	}{
+		{dir + "/a/...", "example.com/m/a", true},
+		{dir + "/a/...", "example.com/m/a/b", true},
+		{dir + "/a/...", "example.com/m/ab", false},
+		{dir + "/a", "example.com/m/a/b", false},
+		{dir + "/a/...", "example.com/m/a/x", false},
+	}
+	for _, tt := range tests {
+		pt := Pattern{
+			Pattern: tt.pattern,
+			Exclude: []string{"example.com/m/a/x"},
+		}
+		if got := pt.Match(&Package{Import: tt.imp}); got != tt.want {
+			t.Errorf("%s matching %s = %v, want %v", tt.pattern, tt.imp, got, tt.want)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package fixme
 
 import (
 	"go/build"
-	"os/exec"
 )
 
 type TestState int
@@ -36,6 +35,27 @@ const (
 	Lint
 )
 
+var actionStrs = map[Action]string{
+	None:  "none",
+	Watch: "watch",
+	Test:  "test",
+	Lint:  "lint",
+}
+
+func (a Action) String() string {
+	return actionStrs[a]
+}
+
+// ParseAction returns the Action named by s, as returned by Action.String.
+func ParseAction(s string) (Action, bool) {
+	for a, str := range actionStrs {
+		if str == s {
+			return a, true
+		}
+	}
+	return None, false
+}
+
 type Package struct {
 	Path         string
 	Import       string
@@ -44,36 +64,98 @@ type Package struct {
 	dependancies []*Package
 	state        TestState
 	Data         string
+	Diagnostics  []Diagnostic
+	runner       Runner
+	// flags are added to the command of each step, by tool name, and env
+	// to its environment
+	flags map[string][]string
+	env   []string
 }
 
-func (p *Package) Test() (string, error) {
-	return p.run("go", "test")
+// Test runs the package's tests. Build, Test and Linter return the combined
+// output of the command, if lines is not nil it is also called with each line
+// of output as it is produced.
+func (p *Package) Test(lines func(string)) (string, error) {
+	return p.run(lines, "go", p.args(ToolTest, "test")...)
 }
 
-func (p *Package) Build() (string, error) {
-	return p.run("go", "build", ".", "errors")
+func (p *Package) Build(lines func(string)) (string, error) {
+	return p.run(lines, "go", append(p.args(ToolBuild, "build"), ".", "errors")...)
 }
 
-func (p *Package) Linter() (string, error) {
+func (p *Package) Linter(lines func(string)) (string, error) {
 	if p.Action != Lint {
 		return "", nil
 	}
-	return p.run("golint")
+	return p.run(lines, "golint", p.args(ToolLint)...)
 }
 
-func (p *Package) run(base string, args ...string) (string, error) {
-	cmd := exec.Command(base, args...)
-	cmd.Dir = p.Path
-	out, err := cmd.CombinedOutput()
-	return string(out), err
+// args returns args followed by the flags for tool.
+func (p *Package) args(tool string, args ...string) []string {
+	return append(args, p.flags[tool]...)
 }
 
+func (p *Package) run(lines func(string), base string, args ...string) (string, error) {
+	r := p.runner
+	if r == nil {
+		r = DefaultRunner
+	}
+	return r.Run(p.Path, p.env, lines, base, args...)
+}
+
+// Imports returns the import paths used by the package.
 func (p *Package) Imports() ([]string, error) {
-	pkg, err := build.Default.Import(p.Import, p.Path, 0)
+	pkg, err := build.Default.ImportDir(p.Path, 0)
+	if err != nil {
+		return nil, err
+	}
+	return dedupe(pkg.Imports), nil
+}
+
+// TestImports returns the import paths used by the package's tests, internal
+// and external (package foo_test). These are kept apart from Imports because
+// a test may import packages that themselves depend on this package, which is
+// only allowed for external tests but can still be in the code.
+func (p *Package) TestImports() ([]string, error) {
+	pkg, err := build.Default.ImportDir(p.Path, 0)
 	if err != nil {
 		return nil, err
 	}
-	return pkg.Imports, nil
+	return dedupe(pkg.TestImports, pkg.XTestImports), nil
+}
+
+func dedupe(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, l := range lists {
+		for _, s := range l {
+			if !seen[s] {
+				seen[s] = true
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// dependsOn reports whether p depends on target, directly or through other
+// packages in the project.
+func (p *Package) dependsOn(target *Package) bool {
+	seen := make(map[*Package]bool)
+	stack := []*Package{p}
+	for len(stack) > 0 {
+		pkg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if pkg == target {
+			return true
+		}
+		if seen[pkg] {
+			continue
+		}
+		seen[pkg] = true
+		stack = append(stack, pkg.dependancies...)
+	}
+	return false
 }
 
 func (p *Package) State() TestState { return p.state }
@@ -86,9 +168,21 @@ func (p *Package) Clone() *Package {
 		Path:   p.Path,
 		Import: p.Import,
 		Action: p.Action,
+		runner: p.runner,
+		flags:  p.flags,
+		env:    p.env,
 	}
 }
 
+// snapshot copies the package along with the result of its last check.
+func (p *Package) snapshot() *Package {
+	cp := p.Clone()
+	cp.state = p.state
+	cp.Data = p.Data
+	cp.Diagnostics = p.Diagnostics
+	return cp
+}
+
 type pkgMap struct {
 	byPath   map[string]*Package
 	byImport map[string]*Package
@@ -113,24 +207,29 @@ func (p *pkgMap) remove(pkg *Package) {
 
 type PackageRecord struct {
 	Import string
+	Path   string
 	Action Action
 }
 
 func (p *Package) PackageRecord() PackageRecord {
 	return PackageRecord{
 		Import: p.Import,
+		Path:   p.Path,
 		Action: p.Action,
 	}
 }
 
 func (p PackageRecord) Package() *Package {
-	if !loaded {
-		load()
-	}
 	pkg := PackageByImport(p.Import)
 	if pkg == nil {
-		return nil
+		// packages outside of GOPATH are not in the index
+		if p.Path == "" || !hasGoFiles(p.Path) {
+			return nil
+		}
+		pkg = packageAt(p.Path, p.Import)
 	}
+	// the index is shared, each project gets its own copy
+	pkg = pkg.Clone()
 	pkg.Action = p.Action
 	return pkg
 }
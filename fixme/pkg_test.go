@@ -0,0 +1,31 @@
+package fixme
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPackageRecordClones(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module example.com/record\n",
+		"a/a.go": "package a\n",
+	})
+	defer os.RemoveAll(dir)
+	rec := PackageRecord{Import: "example.com/record/a", Path: filepath.Join(dir, "a"), Action: Lint}
+
+	// the first load adds the package to the index, the second finds it there
+	for i := 0; i < 2; i++ {
+		pkg := rec.Package()
+		if pkg == nil || pkg.Action != Lint {
+			t.Fatalf("load %d: got %+v", i, pkg)
+		}
+		if pkg == PackageByImport(rec.Import) {
+			t.Errorf("load %d returned the index's package", i)
+		}
+		pkg.state = failBuild
+	}
+	if idx := PackageByImport(rec.Import); idx.Action != None || idx.state != notRun {
+		t.Errorf("the index's package was changed: %+v", idx)
+	}
+}
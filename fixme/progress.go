@@ -0,0 +1,122 @@
+package fixme
+
+import (
+	"sync"
+	"time"
+)
+
+// progressBuffer is the size of the Project.Progress buffer.
+const progressBuffer = 256
+
+// ProgressKind says what a Progress event is reporting.
+type ProgressKind string
+
+const (
+	// RunStarted is sent when an update starts. Trigger is the file that
+	// changed, it's empty if the run wasn't started by the watcher.
+	RunStarted ProgressKind = "run_started"
+	// StepStarted is sent when a step starts on a package.
+	StepStarted ProgressKind = "step_started"
+	// StepOutput is sent for each line of output from a step.
+	StepOutput ProgressKind = "step_output"
+	// StepFinished is sent when a step is done with a package, with how
+	// long it took and whether it failed.
+	StepFinished ProgressKind = "step_finished"
+	// PackageBlocked is sent for the packages that weren't checked because
+	// they depend on the package that failed.
+	PackageBlocked ProgressKind = "package_blocked"
+	// PackageSkipped is sent for the packages that weren't checked because
+	// the run stopped at a failure they don't depend on.
+	PackageSkipped ProgressKind = "package_skipped"
+	// RunFinished is sent when an update is done, before the result is sent
+	// on Project.Update. Package is the failing package, if there is one.
+	RunFinished ProgressKind = "run_finished"
+)
+
+// Progress is sent on Project.Progress as an update runs. Step is one of
+// ToolBuild, ToolTest or ToolLint. Index and Total place the package within
+// the step and Percent is how much of the whole run is done.
+type Progress struct {
+	Kind     ProgressKind
+	Package  string
+	Step     string
+	Line     string
+	Trigger  string
+	Index    int
+	Total    int
+	Percent  int
+	Duration time.Duration
+	Failed   bool
+}
+
+// progressQueue holds the progress events and results of a project until
+// they're sent on Project.Progress and Project.Update, so the run and the
+// project's goroutine never wait for them to be read. They are sent in the
+// order they happened, a result is only sent once the progress before it has
+// been read. Step output is dropped once maxQueuedLines lines are waiting,
+// other events are kept unless maxQueued are waiting, then the oldest go.
+type progressQueue struct {
+	mu     sync.Mutex
+	events []queuedEvent
+	lines  int
+	wake   chan bool
+}
+
+// queuedEvent is a Progress event, or a result if isUpdate is set.
+type queuedEvent struct {
+	progress Progress
+	isUpdate bool
+	update   *Package
+}
+
+const (
+	maxQueuedLines = progressBuffer
+	maxQueued      = 4096
+)
+
+func newProgressQueue() *progressQueue {
+	return &progressQueue{
+		wake: make(chan bool, 1),
+	}
+}
+
+func (q *progressQueue) push(ev queuedEvent) {
+	q.mu.Lock()
+	isLine := !ev.isUpdate && ev.progress.Kind == StepOutput
+	if isLine && q.lines >= maxQueuedLines {
+		q.mu.Unlock()
+		return
+	}
+	if isLine {
+		q.lines++
+	}
+	q.events = append(q.events, ev)
+	if len(q.events) > maxQueued {
+		q.drop()
+	}
+	q.mu.Unlock()
+	select {
+	case q.wake <- true:
+	default:
+	}
+}
+
+func (q *progressQueue) pop() (queuedEvent, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.events) == 0 {
+		return queuedEvent{}, false
+	}
+	ev := q.events[0]
+	q.drop()
+	return ev, true
+}
+
+// drop removes the oldest event, the lock must be held.
+func (q *progressQueue) drop() {
+	if ev := q.events[0]; !ev.isUpdate && ev.progress.Kind == StepOutput {
+		q.lines--
+	}
+	q.events[0] = queuedEvent{}
+	q.events = q.events[1:]
+}
@@ -0,0 +1,100 @@
+package fixme
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressQueueDropsLines(t *testing.T) {
+	q := newProgressQueue()
+	for i := 0; i < maxQueuedLines+10; i++ {
+		q.push(queuedEvent{progress: Progress{Kind: StepOutput}})
+	}
+	q.push(queuedEvent{progress: Progress{Kind: StepFinished}})
+	q.push(queuedEvent{isUpdate: true})
+
+	var lines, finished, updates int
+	for {
+		ev, ok := q.pop()
+		if !ok {
+			break
+		}
+		switch {
+		case ev.isUpdate:
+			updates++
+		case ev.progress.Kind == StepOutput:
+			lines++
+		case ev.progress.Kind == StepFinished:
+			finished++
+		}
+	}
+	if lines != maxQueuedLines || finished != 1 || updates != 1 {
+		t.Errorf("got %d lines, %d finished, %d updates", lines, finished, updates)
+	}
+	if q.lines != 0 {
+		t.Errorf("%d lines still counted", q.lines)
+	}
+}
+
+func TestProgressQueueLimit(t *testing.T) {
+	q := newProgressQueue()
+	for i := 0; i < maxQueued+5; i++ {
+		q.push(queuedEvent{progress: Progress{Kind: StepFinished, Index: i}})
+	}
+	ev, _ := q.pop()
+	if ev.progress.Index != 5 || len(q.events) != maxQueued-1 {
+		t.Errorf("oldest is %d with %d left", ev.progress.Index, len(q.events))
+	}
+}
+
+func TestProgressBeforeUpdate(t *testing.T) {
+	p := newProject([]byte("progress"), "progress")
+	go p.forwardProgress()
+	defer close(p.done)
+
+	pkg := &Package{Import: "example.com/m/a"}
+	p.progress(Progress{Kind: RunStarted})
+	p.progress(Progress{Kind: PackageBlocked, Package: "example.com/m/b"})
+	p.progress(Progress{Kind: RunFinished})
+	p.update(pkg)
+
+	select {
+	case got := <-p.Update:
+		if got != pkg {
+			t.Errorf("got %v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no result")
+	}
+	// by the time the result is sent the progress before it is waiting
+	if len(p.Progress) != 3 {
+		t.Fatalf("result sent with %d progress events waiting", len(p.Progress))
+	}
+	for _, kind := range []ProgressKind{RunStarted, PackageBlocked, RunFinished} {
+		if pr := <-p.Progress; pr.Kind != kind {
+			t.Errorf("got %s, want %s", pr.Kind, kind)
+		}
+	}
+}
+
+func TestUpdateDropsOldest(t *testing.T) {
+	p := newProject([]byte("update"), "update")
+	go p.forwardProgress()
+	defer close(p.done)
+
+	pkgs := make([]*Package, cap(p.Update)+2)
+	for i := range pkgs {
+		pkgs[i] = &Package{Import: string(rune('a' + i))}
+		p.update(pkgs[i])
+	}
+	// events are sent in order, so once this is read the results have been
+	p.progress(Progress{Kind: RunStarted})
+	select {
+	case <-p.Progress:
+	case <-time.After(time.Second):
+		t.Fatal("results not sent")
+	}
+	if got := <-p.Update; got != pkgs[2] {
+		t.Errorf("oldest result is %s, want %s", got.Import, pkgs[2].Import)
+	}
+}
@@ -2,9 +2,13 @@ package fixme
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/fsnotify/fsnotify"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -13,16 +17,47 @@ import (
 // package B and both are in test, then package B will be tested first. If
 // package B is in a failing state, the tests for package A will never run. The
 // watch files will also change the updates.
+//
+// Each project has a goroutine that owns its state. The exported methods send
+// commands to that goroutine and wait for them to finish, so a project can be
+// used from any number of goroutines. Updates run on a separate goroutine
+// against copies of the packages and hand their results back, so commands
+// aren't held up by a long run.
 type Project struct {
 	id         []byte
-	Name       string
+	name       string
 	pkgs       *pkgMap
 	watcher    *fsnotify.Watcher
-	closer     chan bool
+	cmds       chan func()
+	results    chan runResult
+	done       chan bool
+	closed     bool
+	running    bool
+	queued     *runRequest
+	paused     bool
+	pending    bool
+	trigger    string
+	runner     Runner
 	Update     <-chan *Package
 	sendUpdate chan<- *Package
-	testOrder  []*Package
-	tmpWatch   []string
+	// Progress receives events as an update runs and must be read, the
+	// result of a run is only sent on Update once the events before it have
+	// been read. If it isn't read fast enough step output is dropped, other
+	// events are kept.
+	Progress     <-chan Progress
+	sendProgress chan<- Progress
+	queue        *progressQueue
+	history      chan pendingRun
+	testOrder    []*Package
+	tmpWatch     []string
+	patterns     []Pattern
+	// configDir is set if the project is linked to a ConfigName file,
+	// steps, flags and env come from it
+	configDir     string
+	configChanged bool
+	steps         []checkStep
+	flags         map[string][]string
+	env           []string
 }
 
 var seeded bool
@@ -34,37 +69,242 @@ func NewProject() *Project {
 	}
 	id := make([]byte, 8)
 	rand.Read(id)
+	p := newProject(id, "New Project")
+	go p.loop()
+	return p
+}
+
+// newProject creates a project without starting its goroutine so that it can
+// be filled in first.
+func newProject(id []byte, name string) *Project {
 	update := make(chan *Package, 3)
+	progress := make(chan Progress, progressBuffer)
 	return &Project{
-		Name:       "New Project",
-		id:         id,
-		pkgs:       newPkgMap(),
-		Update:     update,
-		sendUpdate: update,
+		name:         name,
+		id:           id,
+		pkgs:         newPkgMap(),
+		cmds:         make(chan func()),
+		results:      make(chan runResult, 1),
+		done:         make(chan bool),
+		Update:       update,
+		sendUpdate:   update,
+		Progress:     progress,
+		sendProgress: progress,
+		queue:        newProgressQueue(),
+		history:      make(chan pendingRun, historyBuffer),
+	}
+}
+
+// NewProjectFromDir creates and saves a project holding every package in the
+// module that contains dir, set to Test. The project is named after the
+// module. If there is no go.mod, dir is treated as the root of a GOPATH
+// project. If the root has a ConfigName file, the project is linked to it
+// instead.
+func NewProjectFromDir(dir string) (*Project, error) {
+	root, name, err := ModuleRoot(dir)
+	if err == ErrNoModule {
+		if root, err = filepath.Abs(dir); err != nil {
+			return nil, err
+		}
+		if name = importForDir(root); name == "" {
+			return nil, errors.New(root + " is not in a module or GOPATH")
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	var cfg *projectConfig
+	if HasConfig(root) {
+		if cfg, err = loadConfig(root); err != nil {
+			return nil, err
+		}
+	}
+
+	p := NewProject()
+	var added int
+	p.do(func() {
+		p.name = name
+		if cfg != nil {
+			p.configDir = root
+			p.applyConfig(cfg)
+			added = len(p.pkgs.byImport)
+		} else {
+			added = len(p.addMatches(Pattern{Pattern: root + "/...", Action: Test}))
+		}
+	})
+	if added == 0 {
+		p.Close()
+		return nil, errors.New("no packages found in " + root)
+	}
+	if err := p.Save(); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// do runs fn on the project's goroutine and waits for it to finish. Once the
+// project is closed, do doesn't run fn.
+func (p *Project) do(fn func()) {
+	done := make(chan bool)
+	select {
+	case p.cmds <- func() {
+		fn()
+		close(done)
+	}:
+		<-done
+	case <-p.done:
 	}
 }
 
+// loop is the goroutine that owns the project.
+func (p *Project) loop() {
+	go p.forwardProgress()
+	go p.writeHistory()
+	var timer <-chan time.Time
+	for !p.closed {
+		var events <-chan fsnotify.Event
+		var errs <-chan error
+		if p.watcher != nil {
+			events, errs = p.watcher.Events, p.watcher.Errors
+		}
+		select {
+		case fn := <-p.cmds:
+			fn()
+		case evt := <-events:
+			if evt.Name == p.configFile() {
+				p.configChanged = true
+			}
+			p.trigger = evt.Name
+			// new directories under an auto pattern may hold new packages
+			if evt.Op&fsnotify.Create != 0 && len(p.patterns) > 0 {
+				if info, err := os.Stat(evt.Name); err == nil && info.IsDir() {
+					p.watcher.Add(evt.Name)
+				}
+			}
+			// restart the timer, if multiple files are being saved, update will
+			// only run once
+			timer = time.After(time.Millisecond * 100)
+		case err := <-errs:
+			fmt.Println(p.name, " Error: ", err)
+		case <-timer:
+			timer = nil
+			if p.paused {
+				p.pending = true
+				continue
+			}
+			p.refresh()
+			p.startRun(runRequest{trigger: p.trigger})
+		case res := <-p.results:
+			p.finishRun(res)
+		}
+	}
+	if p.watcher != nil {
+		p.watcher.Close()
+		p.watcher = nil
+	}
+	close(p.history)
+	close(p.done)
+}
+
+// Close stops watching and stops the project's goroutine. A run that is in
+// progress finishes, but its result isn't sent.
 func (p *Project) Close() {
-	p.closer <- true
+	p.do(func() {
+		p.closed = true
+	})
+}
+
+// Name returns the project's name, which a config file can change.
+func (p *Project) Name() string {
+	var name string
+	p.do(func() {
+		name = p.name
+	})
+	return name
+}
+
+// SetName renames the project.
+func (p *Project) SetName(name string) {
+	p.do(func() {
+		p.name = name
+	})
+}
+
+// SetRunner sets the Runner used to check the project's packages, if r is nil
+// DefaultRunner is used.
+func (p *Project) SetRunner(r Runner) {
+	p.do(func() {
+		p.runner = r
+	})
+}
+
+// Has reports whether the package with the import path imp is in the project.
+func (p *Project) Has(imp string) bool {
+	var ok bool
+	p.do(func() {
+		_, ok = p.pkgs.byImport[imp]
+	})
+	return ok
+}
+
+// imports returns the import paths of every package in the project.
+func (p *Project) imports() map[string]bool {
+	imps := make(map[string]bool)
+	p.do(func() {
+		for imp := range p.pkgs.byImport {
+			imps[imp] = true
+		}
+	})
+	return imps
+}
+
+// Packages returns copies of the packages in the project sorted by import
+// path.
+func (p *Project) Packages() []*Package {
+	var pkgs []*Package
+	p.do(func() {
+		pkgs = make([]*Package, 0, len(p.pkgs.byImport))
+		for _, pkg := range p.pkgs.byImport {
+			pkgs = append(pkgs, pkg.snapshot())
+		}
+	})
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].Import < pkgs[j].Import
+	})
+	return pkgs
 }
 
 func (p *Project) Tests(imp string) *Package {
-	pkg := p.pkgs.byImport[imp]
-	if pkg.Action != Test && pkg.Action != Lint {
-		return nil
-	}
+	var pkg *Package
+	p.do(func() {
+		if found := p.pkgs.byImport[imp]; found != nil && (found.Action == Test || found.Action == Lint) {
+			pkg = found.snapshot()
+		}
+	})
 	return pkg
 }
 
 func (p *Project) Watches(imp string) *Package {
-	pkg := p.pkgs.byImport[imp]
-	if pkg.Action != Watch {
-		return nil
-	}
+	var pkg *Package
+	p.do(func() {
+		if found := p.pkgs.byImport[imp]; found != nil && found.Action == Watch {
+			pkg = found.snapshot()
+		}
+	})
 	return pkg
 }
 
+// Run starts watching the packages in the project and starts an update.
 func (p *Project) Run() error {
+	var err error
+	p.do(func() {
+		err = p.run()
+	})
+	return err
+}
+
+func (p *Project) run() error {
 	if p.watcher != nil {
 		return nil
 	}
@@ -77,100 +317,446 @@ func (p *Project) Run() error {
 		// TODO: us os.Glob to just get Go files.
 		p.watcher.Add(t.Path)
 	}
-	p.closer = make(chan bool)
-	go func() {
-		var timer <-chan time.Time
-		for {
-			select {
-			case <-watcher.Events:
-				// restart the timer, if multiple files are being saved, update will
-				// only run once
-				timer = time.After(time.Millisecond * 100)
-			case err := <-watcher.Errors:
-				fmt.Println(p.Name, " Error: ", err)
-			case <-timer:
-				p.DoUpdate()
-				timer = nil
-			case <-p.closer:
-				watcher.Close()
-				p.watcher = nil
-				return
-			}
-		}
-	}()
-	p.DoUpdate()
+	for _, pt := range p.patterns {
+		p.watchPattern(pt)
+	}
+	if p.configDir != "" {
+		p.watcher.Add(p.configDir)
+	}
+	p.syncAndResolve()
+	p.startRun(runRequest{})
 	return nil
 }
 
-type checkStep func(*Package) *Package
+// refresh reloads the config file if it changed and picks up new packages
+// before a run. While a run is going the config is left until the next one,
+// so the run's results go to the packages it checked.
+func (p *Project) refresh() {
+	if p.configChanged && !p.running {
+		p.configChanged = false
+		p.reloadConfig()
+	}
+	p.syncAndResolve()
+}
+
+// syncAndResolve picks up new packages for the auto patterns before a run.
+// There's no one to return an error to, so it's printed.
+func (p *Project) syncAndResolve() {
+	added, err := p.syncPatterns()
+	if err != nil {
+		fmt.Println(p.name, " Error: ", err)
+	}
+	if len(added) > 0 {
+		p.resolveDependancies()
+	}
+}
+
+// checkStep is one of the checks run on every package. The fn is passed a
+// function to call with each line of output as it's produced and returns the
+// package if it fails.
+type checkStep struct {
+	name string
+	fn   func(pkg *Package, lines func(string)) *Package
+}
+
+// check runs the step at stepIdx on each package in order, stopping at the
+// first failure. The position of the step is used to work out the Percent of
+// the progress events. How each package did is added to res.steps.
+func (p *Project) check(order []*Package, steps []checkStep, stepIdx int, res *runResult) *Package {
+	step := steps[stepIdx]
+	total := len(order)
+	for i, pkg := range order {
+		pr := Progress{
+			Package: pkg.Import,
+			Step:    step.name,
+			Index:   i + 1,
+			Total:   total,
+			Percent: (stepIdx*total + i) * 100 / (len(steps) * total),
+		}
+		pr.Kind = StepStarted
+		p.progress(pr)
 
-func check(pkgs []*Package, fn checkStep) *Package {
-	for _, pkg := range pkgs {
-		if errPkg := fn(pkg); errPkg != nil {
+		lines := func(line string) {
+			if line != "" {
+				out := pr
+				out.Kind, out.Line = StepOutput, line
+				p.progress(out)
+			}
+		}
+		start := time.Now()
+		errPkg := step.fn(pkg, lines)
+		pr.Kind, pr.Duration, pr.Failed = StepFinished, time.Since(start), errPkg != nil
+		p.progress(pr)
+		res.steps = append(res.steps, StepRecord{
+			Package:  pkg.Import,
+			Step:     step.name,
+			Failed:   pr.Failed,
+			Duration: pr.Duration,
+		})
+		if errPkg != nil {
 			return errPkg
 		}
 	}
 	return nil
 }
 
-var checkOrder = []checkStep{builder, tester, linter}
+// reportBlocked sends a progress event for every package that wasn't
+// checked because errPkg failed, the ones after it in the order. The ones
+// before it have already passed the step.
+func (p *Project) reportBlocked(step string, errPkg *Package) {
+	after := false
+	for _, pkg := range p.testOrder {
+		if !after {
+			after = pkg == errPkg
+			continue
+		}
+		kind := PackageSkipped
+		if pkg.dependsOn(errPkg) {
+			kind = PackageBlocked
+		}
+		p.progress(Progress{
+			Kind:    kind,
+			Package: pkg.Import,
+			Step:    step,
+		})
+	}
+}
+
+func (p *Project) progress(pr Progress) {
+	p.queue.push(queuedEvent{
+		progress: pr,
+	})
+}
 
+// update sends the result of a run, after the progress before it, and
+// writes it to the ErrorFile.
+func (p *Project) update(pkg *Package) {
+	if ErrorFile != "" {
+		if err := WriteErrorFile(ErrorFile, pkg, ErrorFileAll); err != nil {
+			fmt.Println(p.name, " Error writing errorfile: ", err)
+		}
+	}
+	p.queue.push(queuedEvent{
+		isUpdate: true,
+		update:   pkg,
+	})
+}
+
+// forwardProgress sends the queued progress on Progress and the results on
+// Update until the project is closed. Progress waits to be read. If nobody is
+// reading Update, the oldest result is dropped rather than holding up the
+// progress after it.
+func (p *Project) forwardProgress() {
+	for {
+		ev, ok := p.queue.pop()
+		if !ok {
+			select {
+			case <-p.queue.wake:
+				continue
+			case <-p.done:
+				return
+			}
+		}
+		if !ev.isUpdate {
+			select {
+			case p.sendProgress <- ev.progress:
+			case <-p.done:
+				return
+			}
+			continue
+		}
+		select {
+		case p.sendUpdate <- ev.update:
+			continue
+		default:
+		}
+		select {
+		case <-p.Update:
+		default:
+		}
+		p.sendUpdate <- ev.update
+	}
+}
+
+var checkOrder = []checkStep{
+	{ToolBuild, builder},
+	{ToolTest, tester},
+	{ToolLint, linter},
+}
+
+// DoUpdate is the same as Rerun.
 func (p *Project) DoUpdate() {
+	p.Rerun()
+}
+
+// runRequest describes a run. If only is set, just that package is checked.
+type runRequest struct {
+	trigger string
+	only    string
+}
+
+// runResult is sent back to the project's goroutine when a run is done. The
+// packages in it are the copies the run used.
+type runResult struct {
+	runRequest
+	order    []*Package
+	failed   *Package
+	step     string
+	steps    []StepRecord
+	checks   int
+	start    time.Time
+	duration time.Duration
+}
+
+// Rerun checks every package now, even if watching is paused. The result is
+// sent on Update.
+func (p *Project) Rerun() {
+	p.do(func() {
+		p.startRun(runRequest{})
+	})
+}
+
+// RerunPackage checks only the package with the import path imp, without
+// checking what it depends on first.
+func (p *Project) RerunPackage(imp string) {
+	p.do(func() {
+		if _, ok := p.pkgs.byImport[imp]; ok {
+			p.startRun(runRequest{only: imp})
+		}
+	})
+}
+
+// Pause stops file changes from starting updates. Changes made while paused
+// start an update when Resume is called.
+func (p *Project) Pause() {
+	p.do(func() {
+		p.paused = true
+	})
+}
+
+// Resume undoes Pause.
+func (p *Project) Resume() {
+	p.do(func() {
+		p.paused = false
+		if p.pending {
+			p.pending = false
+			p.refresh()
+			p.startRun(runRequest{trigger: p.trigger})
+		}
+	})
+}
+
+// startRun starts checking the packages on a new goroutine. Only one run
+// happens at a time, if one is already going the request is queued. A queued
+// run of every package isn't replaced by a run of one package. A run of one
+// package that has been removed since it was asked for is dropped.
+func (p *Project) startRun(req runRequest) {
+	if _, ok := p.pkgs.byImport[req.only]; req.only != "" && !ok {
+		return
+	}
+	if p.running {
+		if p.queued == nil || p.queued.only != "" {
+			p.queued = &req
+		}
+		return
+	}
+	p.running = true
+
 	for _, tmp := range p.tmpWatch {
 		p.watcher.Remove(tmp)
 	}
+	p.tmpWatch = nil
 
-	for i, fn := range checkOrder {
-		errPkg := check(p.testOrder, fn)
-		if errPkg != nil {
-			// if it's a build error, add a temporary watch to failing file
-			if i == 0 {
-				p.addTempWatch(errPkg)
+	var order []*Package
+	if req.only != "" {
+		pkg := p.pkgs.byImport[req.only]
+		pkg.state = notRun
+		order = []*Package{pkg.Clone()}
+	} else {
+		for _, pkg := range p.pkgs.byImport {
+			pkg.state = notRun
+		}
+		for _, pkg := range p.testOrder {
+			order = append(order, pkg.Clone())
+		}
+	}
+	for _, pkg := range order {
+		pkg.runner = p.runner
+		pkg.flags = p.flags
+		pkg.env = p.env
+	}
+	steps := p.steps
+	if len(steps) == 0 {
+		steps = checkOrder
+	}
+
+	p.progress(Progress{
+		Kind:    RunStarted,
+		Trigger: req.trigger,
+		Total:   len(order),
+	})
+	go func() {
+		res := runResult{
+			runRequest: req,
+			order:      order,
+			checks:     len(steps),
+			start:      time.Now(),
+		}
+		for i, step := range steps {
+			if res.failed = p.check(order, steps, i, &res); res.failed != nil {
+				res.step = step.name
+				break
 			}
-			p.sendUpdate <- errPkg
-			return
+		}
+		res.duration = time.Since(res.start)
+		p.results <- res
+	}()
+}
+
+// finishRun copies the result of a run onto the project's packages and sends
+// it on Update.
+func (p *Project) finishRun(res runResult) {
+	p.running = false
+	p.recordRun(res)
+	for _, imp := range res.passed() {
+		if real := p.pkgs.byImport[imp]; real != nil {
+			real.state = passing
 		}
 	}
-	p.sendUpdate <- nil
+	if res.failed == nil {
+		p.progress(Progress{
+			Kind:     RunFinished,
+			Percent:  100,
+			Duration: res.duration,
+		})
+		// after rerunning one package, others may still be failing
+		p.update(p.failing())
+	} else {
+		errPkg := res.failed
+		if real := p.pkgs.byImport[errPkg.Import]; real != nil {
+			real.state = errPkg.state
+			real.Data = errPkg.Data
+			real.Diagnostics = errPkg.Diagnostics
+			if res.only == "" {
+				p.reportBlocked(res.step, real)
+			}
+		}
+		// if it's a build error, add a temporary watch to failing file
+		if res.step == ToolBuild {
+			p.addTempWatch(errPkg)
+		}
+		p.progress(Progress{
+			Kind:     RunFinished,
+			Package:  errPkg.Import,
+			Step:     res.step,
+			Percent:  100,
+			Duration: res.duration,
+			Failed:   true,
+		})
+		p.update(errPkg)
+	}
+
+	if p.queued != nil {
+		req := *p.queued
+		p.queued = nil
+		p.refresh()
+		p.startRun(req)
+	}
 }
 
-func (p *Project) addTempWatch(pkg *Package) {
-	for _, line := range strings.Split(pkg.Data, "\n") {
-		if idx := strings.Index(line, ".go:"); idx != -1 {
-			file := pkg.Path + "/" + line[:idx+3]
-			p.tmpWatch = append(p.tmpWatch, file)
-			p.watcher.Add(file)
+// passed returns the packages that passed every step of the run.
+func (res runResult) passed() []string {
+	count := make(map[string]int)
+	for _, step := range res.steps {
+		if !step.Failed {
+			count[step.Package]++
+		}
+	}
+	var imps []string
+	for _, pkg := range res.order {
+		if count[pkg.Import] == res.checks {
+			imps = append(imps, pkg.Import)
 		}
 	}
+	return imps
 }
 
-func builder(pkg *Package) *Package {
-	str, _ := pkg.Build()
+// failing returns the first package in the test order that failed its last
+// run, or nil.
+func (p *Project) failing() *Package {
+	for _, pkg := range p.testOrder {
+		switch pkg.state {
+		case failBuild, failTest, failLint:
+			return pkg
+		}
+	}
+	return nil
+}
+
+func (p *Project) addTempWatch(pkg *Package) {
+	if p.watcher == nil {
+		return
+	}
+	for _, file := range Files(pkg.Diagnostics) {
+		p.tmpWatch = append(p.tmpWatch, file)
+		p.watcher.Add(file)
+	}
+}
+
+// runFailed fails pkg with state when its command couldn't be run, so a
+// worker that can't be reached doesn't look like every package passing.
+func runFailed(pkg *Package, state TestState, out string, err error) *Package {
+	pkg.state = state
+	pkg.Data = err.Error()
+	if out != "" {
+		pkg.Data = out + "\n" + pkg.Data
+	}
+	pkg.Diagnostics = nil
+	return pkg
+}
+
+func builder(pkg *Package, lines func(string)) *Package {
+	str, err := pkg.Build(lines)
+	if !commandRan(err) {
+		return runFailed(pkg, failBuild, str, err)
+	}
 	if str != "" {
 		pkg.state = failBuild
 		pkg.Data = str
+		pkg.Diagnostics = ParseDiagnostics(pkg.Path, ToolBuild, str)
+		AddContext(pkg.Diagnostics)
 		return pkg
 	}
 	return nil
 }
 
-func tester(pkg *Package) *Package {
-	str, _ := pkg.Test()
+func tester(pkg *Package, lines func(string)) *Package {
+	str, err := pkg.Test(lines)
+	if !commandRan(err) {
+		return runFailed(pkg, failTest, str, err)
+	}
 	strs := strings.Split(str, "\n")
 	if len(strs) >= 3 && strings.TrimSpace(strs[len(strs)-3]) != "PASS" {
 		pkg.state = failTest
 		pkg.Data = str
+		pkg.Diagnostics = ParseDiagnostics(pkg.Path, ToolTest, str)
+		AddContext(pkg.Diagnostics)
 		return pkg
 	}
 
 	return nil
 }
 
-func linter(pkg *Package) *Package {
-	str, _ := pkg.Linter()
+func linter(pkg *Package, lines func(string)) *Package {
+	str, err := pkg.Linter(lines)
+	if !commandRan(err) {
+		return runFailed(pkg, failLint, str, err)
+	}
 	if str != "" {
 		pkg.state = failLint
 		pkg.Data = str
+		pkg.Diagnostics = ParseDiagnostics(pkg.Path, ToolLint, str)
+		AddContext(pkg.Diagnostics)
 		return pkg
 	}
 
@@ -186,6 +772,10 @@ func (p *Project) clearDependancies() {
 }
 
 func (p *Project) ResolveDependancies() {
+	p.do(p.resolveDependancies)
+}
+
+func (p *Project) resolveDependancies() {
 	p.clearDependancies()
 	allTests := make(map[string]map[string]bool) // [importpath][dependancy]
 	for _, tester := range p.pkgs.byPath {
@@ -197,13 +787,33 @@ func (p *Project) ResolveDependancies() {
 			continue
 		}
 		for _, imp := range imps {
-			if pkg, ok := p.pkgs.byImport[imp]; ok {
+			if pkg, ok := p.pkgs.byImport[imp]; ok && pkg != tester {
 				pkg.dependants = append(pkg.dependants, tester)
 				tester.dependancies = append(tester.dependancies, pkg)
 			}
 		}
 	}
 
+	// Tests may import packages that depend on the package under test. Those
+	// edges are only added when they don't close a cycle.
+	for _, tester := range p.pkgs.byPath {
+		if tester.Action == Watch {
+			continue
+		}
+		imps, err := tester.TestImports()
+		if err != nil {
+			continue
+		}
+		for _, imp := range imps {
+			pkg, ok := p.pkgs.byImport[imp]
+			if !ok || pkg == tester || pkg.dependsOn(tester) || tester.dependsOn(pkg) {
+				continue
+			}
+			pkg.dependants = append(pkg.dependants, tester)
+			tester.dependancies = append(tester.dependancies, pkg)
+		}
+	}
+
 	for _, tester := range p.pkgs.byPath {
 		if tester.Action == Watch {
 			continue
@@ -228,7 +838,18 @@ func (p *Project) ResolveDependancies() {
 			remove = append(remove, pkg)
 		}
 		if len(remove) == 0 {
-			panic("no progress")
+			// an import cycle, the rest go in import path order so their
+			// builds report it
+			var cycle []string
+			for imp := range allTests {
+				cycle = append(cycle, imp)
+			}
+			sort.Strings(cycle)
+			fmt.Println(p.name, " Error: import cycle between ", strings.Join(cycle, ", "))
+			for _, imp := range cycle {
+				p.testOrder = append(p.testOrder, p.pkgs.byImport[imp])
+			}
+			return
 		}
 		for _, pkg := range remove {
 			delete(allTests, pkg.Import)
@@ -241,32 +862,143 @@ func (p *Project) ResolveDependancies() {
 	}
 }
 
-func (p *Project) AddTest(pkg *Package) {
-	pkg.Action = Test
-	p.addPkg(pkg)
+// AddTest, AddLint and AddWatch add the package to the project and save it.
+// If saving fails the package is still added. Projects linked to a config file
+// return an error, their packages are changed in the file.
+func (p *Project) AddTest(pkg *Package) error {
+	return p.addPkg(pkg, Test)
+}
+
+func (p *Project) AddLint(pkg *Package) error {
+	return p.addPkg(pkg, Lint)
 }
 
-func (p *Project) AddLint(pkg *Package) {
-	pkg.Action = Lint
-	p.addPkg(pkg)
+func (p *Project) AddWatch(pkg *Package) error {
+	return p.addPkg(pkg, Watch)
 }
 
-func (p *Project) AddWatch(pkg *Package) {
-	pkg.Action = Watch
-	p.addPkg(pkg)
+// addPkg sets the action of the package if it's already in the project,
+// otherwise a copy of pkg is added.
+func (p *Project) addPkg(pkg *Package, action Action) error {
+	var err error
+	p.do(func() {
+		if err = p.configEdit(); err != nil {
+			return
+		}
+		if found, ok := p.pkgs.byImport[pkg.Import]; ok {
+			found.Action = action
+		} else {
+			pkg = pkg.Clone()
+			pkg.Action = action
+			p.track(pkg)
+		}
+		err = p.save()
+	})
+	return err
 }
 
-func (p *Project) addPkg(pkg *Package) {
+func (p *Project) track(pkg *Package) {
 	p.pkgs.add(pkg)
+	watchIndexDir(pkg.Path)
 	if p.watcher != nil {
 		p.watcher.Add(pkg.Path)
 	}
-	p.Save()
 }
 
-func (p *Project) Remove(pkg *Package) {
-	p.pkgs.remove(pkg)
-	p.Save()
+// Remove takes a package out of the project. If an auto pattern matches the
+// package, it is excluded from the pattern so it won't be added back. Like
+// AddTest, it returns an error if the project is linked to a config file.
+func (p *Project) Remove(pkg *Package) error {
+	var err error
+	p.do(func() {
+		if err = p.configEdit(); err != nil {
+			return
+		}
+		p.pkgs.remove(pkg)
+		for i, pt := range p.patterns {
+			if pt.Match(pkg) {
+				p.patterns[i].Exclude = append(pt.Exclude, pkg.Import)
+			}
+		}
+		err = p.save()
+	})
+	return err
+}
+
+// AddPattern adds every package matched by the pattern that is not already in
+// the project, using the pattern's Action. If the pattern is Auto, it is kept
+// with the project and packages that appear under it are added by
+// SyncPatterns. The packages that were added are returned. Like AddTest, it
+// returns an error if the project is linked to a config file.
+func (p *Project) AddPattern(pt Pattern) ([]*Package, error) {
+	var added []*Package
+	var err error
+	p.do(func() {
+		if err = p.configEdit(); err != nil {
+			return
+		}
+		added = snapshots(p.addMatches(pt))
+		if pt.Auto {
+			p.patterns = append(p.patterns, pt)
+			p.watchPattern(pt)
+		}
+		err = p.save()
+	})
+	return added, err
+}
+
+// SyncPatterns adds any new packages that match the project's auto patterns.
+// The packages that were added are returned.
+func (p *Project) SyncPatterns() ([]*Package, error) {
+	var added []*Package
+	var err error
+	p.do(func() {
+		added, err = p.syncPatterns()
+		added = snapshots(added)
+	})
+	return added, err
+}
+
+func (p *Project) syncPatterns() ([]*Package, error) {
+	var added []*Package
+	for _, pt := range p.patterns {
+		added = append(added, p.addMatches(pt)...)
+	}
+	if len(added) > 0 {
+		return added, p.save()
+	}
+	return added, nil
+}
+
+func (p *Project) addMatches(pt Pattern) []*Package {
+	var added []*Package
+	for _, pkg := range pt.Packages() {
+		if _, ok := p.pkgs.byImport[pkg.Import]; ok {
+			continue
+		}
+		pkg = pkg.Clone()
+		pkg.Action = pt.Action
+		p.track(pkg)
+		added = append(added, pkg)
+	}
+	return added
+}
+
+func snapshots(pkgs []*Package) []*Package {
+	out := make([]*Package, len(pkgs))
+	for i, pkg := range pkgs {
+		out[i] = pkg.snapshot()
+	}
+	return out
+}
+
+func (p *Project) watchPattern(pt Pattern) {
+	for _, dir := range pt.Dirs() {
+		watchIndexDir(dir)
+		if p.watcher != nil {
+			p.watcher.Add(dir)
+		}
+	}
 }
 
 func (p *Project) JSON() []byte {
@@ -278,16 +1010,28 @@ func (p *Project) JSON() []byte {
 }
 
 type ProjectRecord struct {
-	Name string
-	ID   []byte
-	Pkgs []PackageRecord
+	Name      string
+	ID        []byte
+	ConfigDir string
+	Pkgs      []PackageRecord
+	Patterns  []Pattern
 }
 
 func (p *Project) ProjectRecord() ProjectRecord {
+	var pr ProjectRecord
+	p.do(func() {
+		pr = p.projectRecord()
+	})
+	return pr
+}
+
+func (p *Project) projectRecord() ProjectRecord {
 	pr := ProjectRecord{
-		Name: p.Name,
-		ID:   p.id,
-		Pkgs: make([]PackageRecord, 0),
+		Name:      p.name,
+		ID:        p.id,
+		ConfigDir: p.configDir,
+		Pkgs:      make([]PackageRecord, 0),
+		Patterns:  append([]Pattern(nil), p.patterns...),
 	}
 	for _, pkg := range p.pkgs.byPath {
 		pr.Pkgs = append(pr.Pkgs, pkg.PackageRecord())
@@ -296,19 +1040,23 @@ func (p *Project) ProjectRecord() ProjectRecord {
 }
 
 func (pr ProjectRecord) Project(id []byte) *Project {
-	update := make(chan *Package, 3)
-	p := &Project{
-		id:         id,
-		Name:       pr.Name,
-		pkgs:       newPkgMap(),
-		Update:     update,
-		sendUpdate: update,
-	}
+	p := newProject(id, pr.Name)
+	p.patterns = pr.Patterns
 	for _, pkgRec := range pr.Pkgs {
 		pkg := pkgRec.Package()
 		if pkg != nil {
 			p.pkgs.add(pkg)
 		}
 	}
+	// the config may have changed while fixme wasn't running
+	if pr.ConfigDir != "" {
+		p.configDir = pr.ConfigDir
+		if cfg, err := loadConfig(p.configDir); err == nil {
+			p.applyConfig(cfg)
+		} else {
+			fmt.Println(p.name, " Error: ", err)
+		}
+	}
+	go p.loop()
 	return p
 }
@@ -0,0 +1,351 @@
+package fixme
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testModule returns a module with a, b importing a and c importing b, and d
+// on its own. The package index is shared, so each test needs its own module
+// path.
+func testModule(mod string) map[string]string {
+	return map[string]string{
+		"go.mod": "module " + mod + "\n",
+		"a/a.go": "package a\n",
+		"b/b.go": "package b\n\nimport _ \"" + mod + "/a\"\n",
+		"c/c.go": "package c\n\nimport _ \"" + mod + "/b\"\n",
+		"d/d.go": "package d\n",
+	}
+}
+
+// testFail is go test output that tester sees as a failure.
+const testFail = "--- FAIL: TestX (0.00s)\nFAIL\nFAIL\texample.com/m/x\t0.01s\n"
+
+var testModules int
+
+// newTestProject creates a project testing every package in a new
+// testModule with a ScriptedRunner. It returns the module's directory and
+// path, the directory is removed when the test ends.
+func newTestProject(t *testing.T) (*Project, *ScriptedRunner, string, string) {
+	return newModuleProject(t, testModule)
+}
+
+// newModuleProject is newTestProject with the module made by files.
+func newModuleProject(t *testing.T, files func(mod string) map[string]string) (*Project, *ScriptedRunner, string, string) {
+	testModules++
+	mod := fmt.Sprintf("example.com/m%d", testModules)
+	dir := writeTree(t, files(mod))
+	p := NewProject()
+	if _, err := p.AddPattern(Pattern{Pattern: dir, Action: Test}); err != nil {
+		t.Fatal(err)
+	}
+	r := NewScriptedRunner()
+	p.SetRunner(r)
+	p.ResolveDependancies()
+	t.Cleanup(func() {
+		p.Close()
+		os.RemoveAll(dir)
+	})
+	return p, r, dir, mod
+}
+
+// waitRun returns the result of the next run and the progress sent before it.
+func waitRun(t *testing.T, p *Project) (*Package, []Progress) {
+	var events []Progress
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case pr := <-p.Progress:
+			events = append(events, pr)
+		case pkg := <-p.Update:
+			for len(p.Progress) > 0 {
+				events = append(events, <-p.Progress)
+			}
+			return pkg, events
+		case <-timeout:
+			t.Fatal("run didn't finish")
+		}
+	}
+}
+
+func states(p *Project) map[string]TestState {
+	s := make(map[string]TestState)
+	for _, pkg := range p.Packages() {
+		s[pkg.Import] = pkg.State()
+	}
+	return s
+}
+
+func TestRerunPackageKeepsFailure(t *testing.T) {
+	p, r, dir, mod := newTestProject(t)
+	r.Set(filepath.Join(dir, "d"), "go test", testFail, nil)
+
+	p.Rerun()
+	if pkg, _ := waitRun(t, p); pkg == nil || pkg.Import != mod+"/d" {
+		t.Fatalf("got %v, want d failing", pkg)
+	}
+	p.RerunPackage(mod + "/c")
+	pkg, _ := waitRun(t, p)
+	if pkg == nil || pkg.Import != mod+"/d" || pkg.State() != failTest {
+		t.Fatalf("c passing reported %v, d is still failing", pkg)
+	}
+	if s := states(p); s[mod+"/c"] != passing {
+		t.Errorf("c is %s after passing", s[mod+"/c"])
+	}
+
+	r.Set(filepath.Join(dir, "d"), "go test", "", nil)
+	p.RerunPackage(mod + "/d")
+	if pkg, _ := waitRun(t, p); pkg != nil {
+		t.Errorf("got %s failing after the last failure was fixed", pkg.Import)
+	}
+}
+
+func TestFailedRunMarksPassing(t *testing.T) {
+	p, r, dir, mod := newTestProject(t)
+	p.do(func() {
+		p.steps = []checkStep{checkOrder[0], checkOrder[1]}
+	})
+	r.Set(filepath.Join(dir, "c"), "go test", testFail, nil)
+
+	p.Rerun()
+	waitRun(t, p)
+	tested := make(map[string]bool)
+	for _, call := range r.Calls() {
+		tested[call] = true
+	}
+	for imp, state := range states(p) {
+		dir := filepath.Join(dir, filepath.Base(imp))
+		switch {
+		case imp == mod+"/c":
+			if state != failTest {
+				t.Errorf("c is %s", state)
+			}
+		case tested[scriptKey(dir, "go test")]:
+			if state != passing {
+				t.Errorf("%s passed every step but is %s", imp, state)
+			}
+		default:
+			if state != notRun {
+				t.Errorf("%s wasn't tested but is %s", imp, state)
+			}
+		}
+	}
+}
+
+func TestRunnerError(t *testing.T) {
+	p, r, dir, mod := newTestProject(t)
+	r.Set(filepath.Join(dir, "a"), "go test", testFail, &ExitError{"exit status 1"})
+	r.Set(filepath.Join(dir, "b"), "go test", "", ErrNotAllowed)
+
+	p.Rerun()
+	pkg, _ := waitRun(t, p)
+	if pkg == nil || pkg.Import != mod+"/a" || pkg.State() != failTest {
+		t.Fatalf("got %v, want a failing", pkg)
+	}
+	if strings.Contains(pkg.Data, ErrNotAllowed.Error()) {
+		t.Errorf("a's exit status was reported: %q", pkg.Data)
+	}
+
+	r.Set(filepath.Join(dir, "a"), "go test", "", nil)
+	p.Rerun()
+	pkg, _ = waitRun(t, p)
+	if pkg == nil || pkg.Import != mod+"/b" || pkg.State() != failTest {
+		t.Fatalf("got %v, want b failing when its tests couldn't run", pkg)
+	}
+	if !strings.Contains(pkg.Data, ErrNotAllowed.Error()) {
+		t.Errorf("got %q, want the runner's error", pkg.Data)
+	}
+}
+
+// ran returns the position of each call made by r.
+func ran(r *ScriptedRunner) map[string]int {
+	pos := make(map[string]int)
+	for i, call := range r.Calls() {
+		pos[call] = i
+	}
+	return pos
+}
+
+func TestDoUpdateOrder(t *testing.T) {
+	p, r, dir, mod := newTestProject(t)
+	if err := p.AddLint(&Package{Import: mod + "/c", Path: filepath.Join(dir, "c")}); err != nil {
+		t.Fatal(err)
+	}
+
+	p.DoUpdate()
+	if pkg, _ := waitRun(t, p); pkg != nil {
+		t.Fatalf("got %s failing", pkg.Import)
+	}
+	pos := ran(r)
+	key := func(name, cmd string) string {
+		return scriptKey(filepath.Join(dir, name), cmd)
+	}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if _, ok := pos[key(name, "go test")]; !ok {
+			t.Errorf("%s wasn't tested", name)
+		}
+	}
+	// a package is checked after what it imports
+	for _, cmd := range []string{"go build . errors", "go test"} {
+		if pos[key("a", cmd)] > pos[key("b", cmd)] || pos[key("b", cmd)] > pos[key("c", cmd)] {
+			t.Errorf("%s didn't run in dependency order: %v", cmd, r.Calls())
+		}
+	}
+	// every package is built before any is tested
+	for _, name := range []string{"a", "b", "c", "d"} {
+		for _, tested := range []string{"a", "b", "c", "d"} {
+			if pos[key(name, "go build . errors")] > pos[key(tested, "go test")] {
+				t.Errorf("%s was built after %s was tested", name, tested)
+			}
+		}
+	}
+	if _, ok := pos[key("c", "golint")]; !ok {
+		t.Error("c is linted but golint didn't run")
+	}
+	if _, ok := pos[key("b", "golint")]; ok {
+		t.Error("golint ran on b, which is only tested")
+	}
+}
+
+func TestDoUpdateBuildFirst(t *testing.T) {
+	p, r, dir, mod := newTestProject(t)
+	// the build failure is reported even though a's tests fail and come first
+	r.Set(filepath.Join(dir, "a"), "go test", testFail, nil)
+	r.Set(filepath.Join(dir, "c"), "go build . errors", "c.go:1:1: broken\n", nil)
+
+	p.DoUpdate()
+	pkg, _ := waitRun(t, p)
+	if pkg == nil || pkg.Import != mod+"/c" || pkg.State() != failBuild {
+		t.Fatalf("got %v, want c failing to build", pkg)
+	}
+	for call := range ran(r) {
+		if strings.HasSuffix(call, ": go test") {
+			t.Errorf("%s ran after a build failed", call)
+		}
+	}
+}
+
+func TestDoUpdateBlocked(t *testing.T) {
+	p, r, dir, mod := newTestProject(t)
+	r.Set(filepath.Join(dir, "a"), "go test", testFail, nil)
+
+	p.DoUpdate()
+	pkg, events := waitRun(t, p)
+	if pkg == nil || pkg.Import != mod+"/a" {
+		t.Fatalf("got %v, want a failing", pkg)
+	}
+	if _, ok := ran(r)[scriptKey(filepath.Join(dir, "b"), "go test")]; ok {
+		t.Error("b was tested after a, which it imports, failed")
+	}
+	kinds := make(map[string]ProgressKind)
+	for _, pr := range events {
+		if pr.Kind == PackageBlocked || pr.Kind == PackageSkipped {
+			kinds[pr.Package] = pr.Kind
+		}
+	}
+	for _, name := range []string{"b", "c"} {
+		if kinds[mod+"/"+name] != PackageBlocked {
+			t.Errorf("%s is %q, want blocked", name, kinds[mod+"/"+name])
+		}
+	}
+	if kind, ok := kinds[mod+"/d"]; ok && kind != PackageSkipped {
+		t.Errorf("d is %q, it doesn't import a", kind)
+	}
+	if _, ok := kinds[mod+"/a"]; ok {
+		t.Error("a failed but was reported as not checked")
+	}
+}
+
+// order returns the names of the packages in the order they're checked.
+func order(p *Project, mod string) []string {
+	var names []string
+	p.do(func() {
+		for _, pkg := range p.testOrder {
+			names = append(names, strings.TrimPrefix(pkg.Import, mod+"/"))
+		}
+	})
+	return names
+}
+
+func TestResolveTestImports(t *testing.T) {
+	p, _, _, mod := newModuleProject(t, func(mod string) map[string]string {
+		files := testModule(mod)
+		// an internal test importing a package that imports a can't build,
+		// but it mustn't stop the project
+		files["a/a_test.go"] = "package a\n\nimport _ \"" + mod + "/b\"\n"
+		// d's tests need c
+		files["d/d_test.go"] = "package d\n\nimport _ \"" + mod + "/c\"\n"
+		return files
+	})
+	if got := order(p, mod); !reflect.DeepEqual(got, []string{"a", "b", "c", "d"}) {
+		t.Errorf("got order %v", got)
+	}
+}
+
+func TestResolveImportCycle(t *testing.T) {
+	p, _, _, mod := newModuleProject(t, func(mod string) map[string]string {
+		files := testModule(mod)
+		files["a/a.go"] = "package a\n\nimport _ \"" + mod + "/c\"\n"
+		return files
+	})
+	got := order(p, mod)
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, []string{"a", "b", "c", "d"}) {
+		t.Errorf("got order %v", got)
+	}
+}
+
+// blockingRunner holds every command until release is closed.
+type blockingRunner struct {
+	*ScriptedRunner
+	started chan bool
+	release chan bool
+}
+
+func (b *blockingRunner) Run(dir string, env []string, lines func(string), name string, args ...string) (string, error) {
+	select {
+	case b.started <- true:
+	default:
+	}
+	<-b.release
+	return b.ScriptedRunner.Run(dir, env, lines, name, args...)
+}
+
+func TestRerunRemovedPackage(t *testing.T) {
+	p, r, _, mod := newTestProject(t)
+	b := &blockingRunner{
+		ScriptedRunner: r,
+		started:        make(chan bool, 1),
+		release:        make(chan bool),
+	}
+	p.SetRunner(b)
+
+	p.Rerun()
+	<-b.started
+	p.RerunPackage(mod + "/d")
+	for _, pkg := range p.Packages() {
+		if pkg.Import == mod+"/d" {
+			if err := p.Remove(pkg); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	close(b.release)
+	if pkg, _ := waitRun(t, p); pkg != nil {
+		t.Fatalf("got %s failing", pkg.Import)
+	}
+	// the queued rerun is dropped and the project keeps going
+	p.Rerun()
+	if pkg, _ := waitRun(t, p); pkg != nil {
+		t.Fatalf("got %s failing", pkg.Import)
+	}
+	if p.Has(mod + "/d") {
+		t.Error("d is still in the project")
+	}
+}
@@ -0,0 +1,297 @@
+package fixme
+
+import (
+	"errors"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// WorkerPath is the path a Worker takes jobs on.
+const WorkerPath = "/run"
+
+// workerJob asks a worker to run one of the checks, Kind is ToolBuild,
+// ToolTest, ToolVet or ToolLint. The worker makes the command itself and
+// only adds the Flags it allows. Dir is relative to the worker's root when
+// the coordinator could make it relative to its own.
+type workerJob struct {
+	Kind   string
+	Dir    string
+	Env    []string
+	Flags  []string
+	Stream bool
+}
+
+// workerMsg is sent back by a worker, one with a Line for each line of output
+// if the job asked for them, then one that is Done. Exit is set if Err is the
+// command's exit status.
+type workerMsg struct {
+	Line   string
+	Done   bool
+	Output string
+	Err    string
+	Exit   bool
+}
+
+// RemoteRunner is a Runner that sends each command to a Worker at Addr,
+// "host:port". Directories under Root are sent relative to it so the worker
+// can run them in its own checkout of the same code.
+type RemoteRunner struct {
+	Addr string
+	Root string
+}
+
+func (r *RemoteRunner) Run(dir string, env []string, lines func(string), name string, args ...string) (string, error) {
+	job, ok := newWorkerJob(name, args)
+	if !ok {
+		return "", ErrNotAllowed
+	}
+	job.Dir, job.Env, job.Stream = dir, env, lines != nil
+	if r.Root != "" {
+		if rel, err := filepath.Rel(r.Root, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			job.Dir = filepath.ToSlash(rel)
+		}
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+r.Addr+WorkerPath, nil)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(job); err != nil {
+		return "", err
+	}
+	for {
+		var msg workerMsg
+		if err := conn.ReadJSON(&msg); err != nil {
+			return "", err
+		}
+		if !msg.Done {
+			if lines != nil {
+				lines(msg.Line)
+			}
+			continue
+		}
+		if msg.Exit {
+			return msg.Output, &ExitError{msg.Err}
+		}
+		if msg.Err != "" {
+			return msg.Output, errors.New(msg.Err)
+		}
+		return msg.Output, nil
+	}
+}
+
+// ErrNotAllowed is returned to a coordinator that asks a worker to run a
+// command it doesn't allow or to run outside of its root.
+var ErrNotAllowed = errors.New("not allowed by worker")
+
+// Worker is an http.Handler that runs jobs sent by a RemoteRunner. Relative
+// directories are run under Root and, if Root is set, nothing outside of it is
+// run. Jobs only name the check and the worker makes the command, so only
+// golint and go build, test and vet are run, with the flags in workerFlags.
+// Jobs can only set the environment variables named in Env. Those still run
+// the code in the checkout, so a worker should only listen where the
+// coordinators are trusted.
+type Worker struct {
+	Root     string
+	Runner   Runner
+	Env      map[string]bool
+	upgrader websocket.Upgrader
+}
+
+// DefaultWorkerEnv are the environment variables a Worker lets jobs set
+// unless it's told otherwise. Variables that name programs to run, like CC or
+// GOFLAGS, which can add -toolexec, aren't included.
+var DefaultWorkerEnv = []string{
+	"CGO_ENABLED",
+	"GO111MODULE",
+	"GOARCH",
+	"GODEBUG",
+	"GOMAXPROCS",
+	"GOOS",
+	"GORACE",
+	"GOTRACEBACK",
+	"TZ",
+}
+
+func NewWorker(root string) (*Worker, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	wk := &Worker{
+		Root:   root,
+		Runner: ExecRunner{},
+		Env:    make(map[string]bool),
+	}
+	for _, name := range DefaultWorkerEnv {
+		wk.Env[name] = true
+	}
+	return wk, nil
+}
+
+// newWorkerJob works out the kind of check a command made by Package is and
+// the flags that were added to it.
+func newWorkerJob(name string, args []string) (workerJob, bool) {
+	if name == "golint" {
+		return workerJob{Kind: ToolLint, Flags: args}, true
+	}
+	if name != "go" || len(args) == 0 {
+		return workerJob{}, false
+	}
+	job := workerJob{Kind: args[0], Flags: args[1:]}
+	switch job.Kind {
+	case ToolBuild:
+		n := len(job.Flags)
+		if n < 2 || job.Flags[n-2] != "." || job.Flags[n-1] != "errors" {
+			return workerJob{}, false
+		}
+		job.Flags = job.Flags[:n-2]
+	case ToolTest, ToolVet:
+	default:
+		return workerJob{}, false
+	}
+	return job, true
+}
+
+// workerFlags are the flags a worker adds to each kind of job, and whether
+// they take a value. Anything that names a program or file to run or write,
+// like -exec, -toolexec, -vettool or -o, isn't allowed.
+var workerFlags = map[string]map[string]bool{
+	ToolBuild: workerGoFlags,
+	ToolTest:  workerGoFlags,
+	ToolVet:   workerGoFlags,
+	ToolLint: {
+		"min_confidence":  true,
+		"set_exit_status": false,
+	},
+}
+
+var workerGoFlags = map[string]bool{
+	"bench":     true,
+	"benchmem":  false,
+	"benchtime": true,
+	"count":     true,
+	"cover":     false,
+	"covermode": true,
+	"cpu":       true,
+	"failfast":  false,
+	"json":      false,
+	"mod":       true,
+	"p":         true,
+	"race":      false,
+	"run":       true,
+	"short":     false,
+	"skip":      true,
+	"tags":      true,
+	"timeout":   true,
+	"trimpath":  false,
+	"v":         false,
+}
+
+// command returns the command for a job, or false if the job isn't allowed.
+// Every flag has to be in workerFlags, with its value in the same argument
+// or the next one.
+func (job workerJob) command() (string, []string, bool) {
+	allowed, ok := workerFlags[job.Kind]
+	if !ok {
+		return "", nil, false
+	}
+	for i := 0; i < len(job.Flags); i++ {
+		flag := job.Flags[i]
+		if !strings.HasPrefix(flag, "-") {
+			return "", nil, false
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(flag, "-"), "-")
+		hasValue := false
+		if eq := strings.Index(name, "="); eq >= 0 {
+			name, hasValue = name[:eq], true
+		}
+		takesValue, ok := allowed[name]
+		if !ok {
+			return "", nil, false
+		}
+		if takesValue && !hasValue {
+			// the value is the next argument
+			i++
+			if i == len(job.Flags) {
+				return "", nil, false
+			}
+		}
+	}
+
+	flags := append([]string(nil), job.Flags...)
+	switch job.Kind {
+	case ToolLint:
+		return "golint", flags, true
+	case ToolBuild:
+		return "go", append(append([]string{job.Kind}, flags...), ".", "errors"), true
+	}
+	return "go", append([]string{job.Kind}, flags...), true
+}
+
+func (wk *Worker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := wk.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var job workerJob
+	if err := conn.ReadJSON(&job); err != nil {
+		return
+	}
+	dir, err := wk.dir(job)
+	if err != nil {
+		conn.WriteJSON(workerMsg{
+			Done: true,
+			Err:  err.Error(),
+		})
+		return
+	}
+
+	var lines func(string)
+	if job.Stream {
+		lines = func(line string) {
+			conn.WriteJSON(workerMsg{
+				Line: line,
+			})
+		}
+	}
+	name, args, _ := job.command()
+	out, err := wk.Runner.Run(dir, job.Env, lines, name, args...)
+	msg := workerMsg{
+		Done:   true,
+		Output: out,
+	}
+	if err != nil {
+		msg.Err = err.Error()
+		msg.Exit = commandRan(err)
+	}
+	conn.WriteJSON(msg)
+}
+
+// dir works out where a job runs and checks that it's allowed.
+func (wk *Worker) dir(job workerJob) (string, error) {
+	if _, _, ok := job.command(); !ok {
+		return "", ErrNotAllowed
+	}
+	for _, kv := range job.Env {
+		if eq := strings.Index(kv, "="); eq <= 0 || !wk.Env[kv[:eq]] {
+			return "", ErrNotAllowed
+		}
+	}
+	dir := filepath.FromSlash(job.Dir)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(wk.Root, dir)
+	}
+	dir = filepath.Clean(dir)
+	if wk.Root != "" {
+		if rel, err := filepath.Rel(wk.Root, dir); err != nil || strings.HasPrefix(rel, "..") {
+			return "", ErrNotAllowed
+		}
+	}
+	return dir, nil
+}
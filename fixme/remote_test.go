@@ -0,0 +1,126 @@
+package fixme
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewWorkerJob(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		kind  string
+		flags []string
+		ok    bool
+	}{
+		{"go", []string{"build", "-tags", "x", ".", "errors"}, ToolBuild, []string{"-tags", "x"}, true},
+		{"go", []string{"test", "-v"}, ToolTest, []string{"-v"}, true},
+		{"go", []string{"vet"}, ToolVet, []string{}, true},
+		{"golint", []string{"-min_confidence=0.3"}, ToolLint, []string{"-min_confidence=0.3"}, true},
+		{"go", []string{"build"}, "", nil, false},
+		{"go", []string{"run", "."}, "", nil, false},
+		{"go", nil, "", nil, false},
+		{"sh", []string{"-c", "true"}, "", nil, false},
+	}
+	for _, tt := range tests {
+		job, ok := newWorkerJob(tt.name, tt.args)
+		if ok != tt.ok || job.Kind != tt.kind || (ok && !reflect.DeepEqual(job.Flags, tt.flags)) {
+			t.Errorf("%s %v: got %q %v %v", tt.name, tt.args, job.Kind, job.Flags, ok)
+		}
+	}
+}
+
+func TestWorkerJobCommand(t *testing.T) {
+	tests := []struct {
+		kind  string
+		flags []string
+		want  string
+	}{
+		{ToolBuild, nil, "go build . errors"},
+		{ToolBuild, []string{"-tags", "a b"}, "go build -tags a b . errors"},
+		{ToolTest, []string{"-v", "-run=TestA", "--count", "1"}, "go test -v -run=TestA --count 1"},
+		// the value of -run isn't a flag
+		{ToolTest, []string{"-run", "-exec"}, "go test -run -exec"},
+		{ToolLint, []string{"-set_exit_status"}, "golint -set_exit_status"},
+		{ToolTest, []string{"-exec", "sh"}, ""},
+		{ToolTest, []string{"-exec=sh"}, ""},
+		{ToolTest, []string{"-toolexec", "sh"}, ""},
+		{ToolVet, []string{"-vettool=/bin/sh"}, ""},
+		{ToolBuild, []string{"-o", "/tmp/x"}, ""},
+		{ToolBuild, []string{"-ldflags", "-X a.b=c"}, ""},
+		{ToolTest, []string{"-args", "-x"}, ""},
+		// packages other than the one in the directory can't be named
+		{ToolTest, []string{"../other"}, ""},
+		// a flag missing its value would take the next thing the worker adds
+		{ToolBuild, []string{"-tags"}, ""},
+		{ToolLint, []string{"-v"}, ""},
+		{"run", nil, ""},
+	}
+	for _, tt := range tests {
+		name, args, ok := workerJob{Kind: tt.kind, Flags: tt.flags}.command()
+		got := ""
+		if ok {
+			got = strings.Join(append([]string{name}, args...), " ")
+		}
+		if got != tt.want {
+			t.Errorf("%s %v: got %q, want %q", tt.kind, tt.flags, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteRunner(t *testing.T) {
+	script := NewScriptedRunner()
+	script.Set("/worker/a", "go test -v", "ok\nPASS\n", nil)
+	wk := &Worker{
+		Root:   "/worker",
+		Runner: script,
+		Env:    map[string]bool{"GOOS": true},
+	}
+	srv := httptest.NewServer(wk)
+	defer srv.Close()
+	r := &RemoteRunner{
+		Addr: strings.TrimPrefix(srv.URL, "http://"),
+		Root: "/local",
+	}
+
+	var lines []string
+	out, err := r.Run("/local/a", nil, func(line string) {
+		lines = append(lines, line)
+	}, "go", "test", "-v")
+	if err != nil || out != "ok\nPASS\n" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	if !reflect.DeepEqual(lines, []string{"ok", "PASS"}) {
+		t.Errorf("got lines %q", lines)
+	}
+
+	if _, err := r.Run("/local/a", nil, nil, "go", "test", "-exec", "sh"); err == nil || err.Error() != ErrNotAllowed.Error() {
+		t.Errorf("got %v running -exec", err)
+	}
+	if _, err := r.Run("/elsewhere", nil, nil, "go", "test"); err == nil || err.Error() != ErrNotAllowed.Error() {
+		t.Errorf("got %v running outside of the worker's root", err)
+	}
+	if _, err := r.Run("/local/a", nil, nil, "sh", "-c", "true"); err != ErrNotAllowed {
+		t.Errorf("got %v sending a command that isn't a check", err)
+	}
+	if _, err := r.Run("/local/a", []string{"GOFLAGS=-toolexec=sh"}, nil, "go", "test"); err == nil || err.Error() != ErrNotAllowed.Error() {
+		t.Errorf("got %v setting an environment variable that isn't allowed", err)
+	}
+	if _, err := r.Run("/local/a", []string{"GOOS=linux"}, nil, "go", "test", "-v"); err != nil {
+		t.Errorf("got %v setting an allowed environment variable", err)
+	}
+	if calls := script.Calls(); len(calls) != 2 {
+		t.Errorf("worker ran %v", calls)
+	}
+
+	// the command's exit status comes back as one
+	script.Set("/worker/b", "go test", testFail, &ExitError{"exit status 1"})
+	if out, err := r.Run("/local/b", nil, nil, "go", "test"); out != testFail || !commandRan(err) {
+		t.Errorf("got %q, %v from a failing test", out, err)
+	}
+	if _, err := r.Run("/local/a", nil, nil, "go", "test", "-exec", "sh"); commandRan(err) {
+		t.Error("a command the worker didn't allow looks like it ran")
+	}
+}
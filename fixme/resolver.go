@@ -1,77 +1,386 @@
 package fixme
 
 import (
+	"fmt"
+	"github.com/fsnotify/fsnotify"
 	"go/build"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 //https://github.com/cespare/deplist/blob/master/deplist.go
 
-var packageNames map[string][]*Package
-var packageImports map[string]*Package
+// pkgIndex holds every directory under the source roots by name, import path
+// and path on disk. The records from the scan that built it are kept so they
+// can be cached.
+type pkgIndex struct {
+	names   map[string][]*Package
+	imports map[string]*Package
+	paths   map[string]*Package
+	records map[string]indexRecord
+}
+
+// indexRecord is what is cached for each directory that was scanned. If the
+// directory's ModTime hasn't changed, the Dirs inside it haven't either.
+type indexRecord struct {
+	Import  string
+	ModTime int64
+	Dirs    []string
+}
+
+func newPkgIndex() *pkgIndex {
+	return &pkgIndex{
+		names:   make(map[string][]*Package),
+		imports: make(map[string]*Package),
+		paths:   make(map[string]*Package),
+		records: make(map[string]indexRecord),
+	}
+}
+
+// cachedIndex builds an index from the cache without touching the file
+// system.
+func cachedIndex(cache map[string]indexRecord) *pkgIndex {
+	idx := newPkgIndex()
+	for path, rec := range cache {
+		if rec.Import != "" {
+			idx.add(&Package{
+				Path:   path,
+				Import: rec.Import,
+			})
+		}
+	}
+	idx.records = cache
+	return idx
+}
+
+func (idx *pkgIndex) add(pkg *Package) {
+	if pkg.Import != "" {
+		_, name := filepath.Split(pkg.Import)
+		idx.names[name] = append(idx.names[name], pkg)
+		idx.imports[pkg.Import] = pkg
+	}
+	idx.paths[pkg.Path] = pkg
+}
+
+// removeTree removes dir and every directory under it.
+func (idx *pkgIndex) removeTree(dir string) {
+	for path, pkg := range idx.paths {
+		if path != dir && !strings.HasPrefix(path, dir+"/") {
+			continue
+		}
+		delete(idx.paths, path)
+		if pkg.Import == "" {
+			continue
+		}
+		delete(idx.imports, pkg.Import)
+		_, name := filepath.Split(pkg.Import)
+		pkgs := idx.names[name]
+		for i, p := range pkgs {
+			if p == pkg {
+				idx.names[name] = append(pkgs[:i:i], pkgs[i+1:]...)
+				break
+			}
+		}
+	}
+}
 
-var loaded bool
+// The index is built on first use and kept current by indexWatcher, which
+// watches the source roots and the directories in indexDirs. Scans
+// build a new pkgIndex without holding indexMu and only lock to swap or merge
+// the result in, so lookups are never blocked by a scan. The index is cached
+// in Bolt, if there is a cache it is used right away and the directories that
+// have changed since it was saved are rescanned in the background.
+var (
+	indexMu      sync.RWMutex
+	index        = newPkgIndex()
+	loadOnce     sync.Once
+	rescanning   int32
+	indexWatcher *fsnotify.Watcher
+	indexDirs    = make(map[string]bool)
+)
 
 func load() {
-	packageNames = make(map[string][]*Package)
-	packageImports = make(map[string]*Package)
-	var dirs []*Package
+	loadOnce.Do(func() {
+		cache := loadIndexCache()
+		if len(cache) == 0 {
+			rescan(nil)
+			go watchIndex()
+			return
+		}
+		setIndex(cachedIndex(cache))
+		go func() {
+			rescan(cache)
+			watchIndex()
+		}()
+	})
+}
+
+func srcRoots() []*Package {
+	var roots []*Package
 	for _, dir := range build.Default.SrcDirs() {
-		dirs = append(dirs, &Package{
+		roots = append(roots, &Package{
 			Path: dir,
 		})
 	}
+	return roots
+}
+
+// Rescan rebuilds the package index from the source roots, ignoring the
+// cache. Lookups and searches use the old index until the scan is done. If a
+// rescan is already running, Rescan returns without doing anything.
+func Rescan() {
+	load()
+	rescan(nil)
+}
+
+func rescan(cache map[string]indexRecord) {
+	if !atomic.CompareAndSwapInt32(&rescanning, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&rescanning, 0)
+
+	idx := scan(srcRoots(), cache)
+	setIndex(idx)
+	saveIndexCache(idx.records)
+}
+
+func setIndex(idx *pkgIndex) {
+	indexMu.Lock()
+	// packages outside of the source roots were added by packageAt and
+	// won't be found by the scan
+	for path, pkg := range index.paths {
+		if !underSrcRoot(path) {
+			idx.add(pkg)
+		}
+	}
+	index = idx
+	indexMu.Unlock()
+}
+
+// scan walks the directories under roots, including the roots themselves if
+// they have an import path. Packages that are already in the index are
+// reused so projects holding them stay in sync. Directories that haven't
+// changed since they were cached aren't read again.
+func scan(roots []*Package, cache map[string]indexRecord) *pkgIndex {
+	idx := newPkgIndex()
+	dirs := roots
 	for i := 0; i < len(dirs); i++ {
 		dir := dirs[i]
 		if dir.Import != "" {
-			_, name := filepath.Split(dir.Import)
-			packageNames[name] = append(packageNames[name], dir)
-			packageImports[dir.Import] = dir
+			idx.add(dir)
 		}
 
-		f, err := os.Open(dir.Path)
+		info, err := os.Stat(dir.Path)
 		if err != nil {
 			continue
 		}
-		children, err := f.Readdir(-1)
-		f.Close()
-		if err != nil {
-			continue
+		rec, ok := cache[dir.Path]
+		if !ok || rec.ModTime != info.ModTime().UnixNano() || rec.Import != dir.Import {
+			rec = indexRecord{
+				Import:  dir.Import,
+				ModTime: info.ModTime().UnixNano(),
+			}
+			if rec.Dirs, err = readDirs(dir.Path); err != nil {
+				continue
+			}
 		}
-		for _, child := range children {
-			if child.IsDir() {
-				name := child.Name()
-				if name[0] == '.' {
-					continue
-				}
-				var i string
-				if dir.Import == "" {
-					i = name
-				} else {
-					i = dir.Import + "/" + name
-				}
-				c := &Package{
-					Path:   dir.Path + "/" + name,
-					Import: i,
+		idx.records[dir.Path] = rec
+
+		for _, name := range rec.Dirs {
+			dirs = append(dirs, indexed(dir.Path+"/"+name, childImport(dir.Import, name)))
+		}
+	}
+	return idx
+}
+
+// readDirs returns the names of the directories in path that aren't hidden.
+func readDirs(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	children, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, child := range children {
+		if child.IsDir() {
+			name := child.Name()
+			if name[0] == '.' {
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func childImport(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "/" + name
+}
+
+// indexed returns the package already in the index at path with the import
+// path imp or a new one. It doesn't call load because it is used by load.
+func indexed(path, imp string) *Package {
+	indexMu.RLock()
+	pkg := index.imports[imp]
+	indexMu.RUnlock()
+	if pkg != nil && pkg.Path == path {
+		return pkg
+	}
+	return &Package{
+		Path:   path,
+		Import: imp,
+	}
+}
+
+// watchIndex keeps the index current as directories are created and removed
+// in the source roots and the directories projects use.
+func watchIndex() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Println("Package index error: ", err)
+		return
+	}
+	indexMu.Lock()
+	indexWatcher = watcher
+	dirs := build.Default.SrcDirs()
+	for dir := range indexDirs {
+		dirs = append(dirs, dir)
+	}
+	indexMu.Unlock()
+	for _, dir := range dirs {
+		addIndexWatch(watcher, dir)
+	}
+
+	for {
+		select {
+		case evt, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if evt.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(evt.Name); err == nil && info.IsDir() {
+					addTree(evt.Name)
 				}
-				dirs = append(dirs, c)
+			} else if evt.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				indexMu.Lock()
+				index.removeTree(evt.Name)
+				indexMu.Unlock()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
 			}
+			fmt.Println("Package index error: ", err)
 		}
 	}
-	loaded = true
 }
 
-func PackageByName(name string) []*Package {
-	if !loaded {
-		load()
+// watchIndexDir adds new directories in dir to the index as they're created.
+// Only the directories projects use are watched, watching every directory in
+// a large GOPATH runs out of inotify watches.
+func watchIndexDir(dir string) {
+	indexMu.Lock()
+	if indexDirs[dir] {
+		indexMu.Unlock()
+		return
+	}
+	indexDirs[dir] = true
+	watcher := indexWatcher
+	indexMu.Unlock()
+	if watcher != nil {
+		addIndexWatch(watcher, dir)
+	}
+}
+
+func addIndexWatch(watcher *fsnotify.Watcher, dir string) {
+	if err := watcher.Add(dir); err != nil {
+		fmt.Println("Package index error: could not watch ", dir, ": ", err)
+	}
+}
+
+// addTree scans a new directory and merges it into the index.
+func addTree(path string) {
+	name := filepath.Base(path)
+	if name[0] == '.' {
+		return
+	}
+	parent := filepath.Dir(path)
+	var parentImport string
+	if p := packageByPath(parent); p != nil {
+		parentImport = p.Import
+	} else if !isSrcRoot(parent) {
+		return
+	}
+
+	idx := scan([]*Package{indexed(path, childImport(parentImport, name))}, nil)
+	indexMu.Lock()
+	index.removeTree(path)
+	for _, pkg := range idx.paths {
+		index.add(pkg)
+	}
+	indexMu.Unlock()
+}
+
+func isSrcRoot(dir string) bool {
+	for _, root := range build.Default.SrcDirs() {
+		if root == dir {
+			return true
+		}
 	}
-	return packageNames[name]
+	return false
+}
+
+func underSrcRoot(path string) bool {
+	for _, root := range build.Default.SrcDirs() {
+		if strings.HasPrefix(path, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func packageByPath(path string) *Package {
+	indexMu.RLock()
+	defer indexMu.RUnlock()
+	return index.paths[path]
+}
+
+func PackageByName(name string) []*Package {
+	load()
+	indexMu.RLock()
+	defer indexMu.RUnlock()
+	return index.names[name]
 }
 
 func PackageByImport(imp string) *Package {
-	if !loaded {
-		load()
+	load()
+	indexMu.RLock()
+	defer indexMu.RUnlock()
+	return index.imports[imp]
+}
+
+// packageAt returns the package with the import path imp, adding it to the
+// index if it is not already there.
+func packageAt(dir, imp string) *Package {
+	if pkg := PackageByImport(imp); pkg != nil {
+		return pkg
+	}
+	pkg := &Package{
+		Path:   dir,
+		Import: imp,
 	}
-	return packageImports[imp]
+	indexMu.Lock()
+	index.add(pkg)
+	indexMu.Unlock()
+	return pkg
 }
@@ -0,0 +1,141 @@
+package fixme
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Runner runs the commands that check a package. Run runs name with args in
+// dir, with env added to the environment, and returns the combined stdout and
+// stderr. If lines is not nil it is called with each line of output as it is
+// produced.
+type Runner interface {
+	Run(dir string, env []string, lines func(string), name string, args ...string) (string, error)
+}
+
+// ExitError is returned by a Runner when the command ran but exited with an
+// error status, like *exec.ExitError is for an ExecRunner.
+type ExitError struct {
+	Msg string
+}
+
+func (e *ExitError) Error() string {
+	return e.Msg
+}
+
+// commandRan reports whether err from a Runner is nil or only says the
+// command exited with an error status. The checks look at the output for
+// those, any other error means the command couldn't be run.
+func commandRan(err error) bool {
+	switch err.(type) {
+	case nil, *exec.ExitError, *ExitError:
+		return true
+	}
+	return false
+}
+
+// DefaultRunner is used by packages that haven't been given a Runner.
+var DefaultRunner Runner = ExecRunner{}
+
+// ExecRunner runs commands on this machine.
+type ExecRunner struct{}
+
+func (ExecRunner) Run(dir string, env []string, lines func(string), name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if lines == nil {
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	r, w := io.Pipe()
+	cmd.Stdout = w
+	cmd.Stderr = w
+	var out bytes.Buffer
+	done := make(chan bool)
+	go func() {
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadString('\n')
+			out.WriteString(line)
+			if line != "" {
+				lines(strings.TrimRight(line, "\r\n"))
+			}
+			if err != nil {
+				break
+			}
+		}
+		close(done)
+	}()
+	err := cmd.Run()
+	w.Close()
+	<-done
+	return out.String(), err
+}
+
+// Script is the result a ScriptedRunner gives for a command.
+type Script struct {
+	Output string
+	Err    error
+}
+
+// ScriptedRunner is a Runner that doesn't run anything, it returns the Script
+// set for the directory and command. A command without a Script succeeds with
+// no output. Every command is recorded so the order they ran in can be
+// checked. The env is ignored.
+type ScriptedRunner struct {
+	mu      sync.Mutex
+	scripts map[string]Script
+	calls   []string
+}
+
+func NewScriptedRunner() *ScriptedRunner {
+	return &ScriptedRunner{
+		scripts: make(map[string]Script),
+	}
+}
+
+// Set the result for cmd run in dir, where cmd is the command and its args
+// separated by spaces, "go test".
+func (s *ScriptedRunner) Set(dir, cmd string, output string, err error) {
+	s.mu.Lock()
+	s.scripts[scriptKey(dir, cmd)] = Script{
+		Output: output,
+		Err:    err,
+	}
+	s.mu.Unlock()
+}
+
+func (s *ScriptedRunner) Run(dir string, env []string, lines func(string), name string, args ...string) (string, error) {
+	key := scriptKey(dir, strings.Join(append([]string{name}, args...), " "))
+	s.mu.Lock()
+	s.calls = append(s.calls, key)
+	script := s.scripts[key]
+	s.mu.Unlock()
+
+	if lines != nil && script.Output != "" {
+		for _, line := range strings.Split(strings.TrimRight(script.Output, "\n"), "\n") {
+			lines(line)
+		}
+	}
+	return script.Output, script.Err
+}
+
+// Calls returns every command that has been run as "dir: cmd", oldest first.
+func (s *ScriptedRunner) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func scriptKey(dir, cmd string) string {
+	return dir + ": " + cmd
+}
@@ -0,0 +1,128 @@
+package fixme
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SearchResult is a package found by Search along with how well it matched.
+type SearchResult struct {
+	*Package
+	Score     int
+	InProject bool
+}
+
+// Scores for the ways a query can match an import path. Packages that are
+// already in the project get scoreInProject added, which is less than the
+// gap between match types.
+const (
+	scoreExact         = 100
+	scoreNamePrefix    = 80
+	scorePathPrefix    = 70
+	scoreElementPrefix = 60
+	scoreSubstring     = 50
+	scoreFuzzyMax      = 40
+	scoreInProject     = 5
+)
+
+// Search finds packages whose import path matches query, ignoring case. Exact
+// matches rank highest, followed by prefix, substring and fuzzy matches, where
+// every character of the query appears in order. Packages in p rank above
+// packages that match equally well but are not; p can be nil. At most limit
+// results are returned, if limit is less than 1 all results are returned.
+func Search(query string, p *Project, limit int) []SearchResult {
+	load()
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil
+	}
+
+	var inProject map[string]bool
+	if p != nil {
+		inProject = p.imports()
+	}
+
+	var results []SearchResult
+	indexMu.RLock()
+	for imp, pkg := range index.imports {
+		score := matchScore(query, strings.ToLower(imp))
+		if score == 0 {
+			continue
+		}
+		r := SearchResult{
+			Package: pkg,
+			Score:   score,
+		}
+		if inProject[imp] {
+			r.InProject = true
+			r.Score += scoreInProject
+		}
+		results = append(results, r)
+	}
+	indexMu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if len(results[i].Import) != len(results[j].Import) {
+			return len(results[i].Import) < len(results[j].Import)
+		}
+		return results[i].Import < results[j].Import
+	})
+
+	// Directories without Go files are in the index, but they aren't
+	// packages. Only check the ones that will be returned.
+	out := results[:0]
+	for _, r := range results {
+		if limit > 0 && len(out) == limit {
+			break
+		}
+		if hasGoFiles(r.Path) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// matchScore returns how well query matches the import path imp, both should
+// already be lower case. Zero means no match.
+func matchScore(query, imp string) int {
+	_, name := filepath.Split(imp)
+	switch {
+	case name == query || imp == query:
+		return scoreExact
+	case strings.HasPrefix(name, query):
+		return scoreNamePrefix
+	case strings.HasPrefix(imp, query):
+		return scorePathPrefix
+	case strings.Contains("/"+imp, "/"+query):
+		return scoreElementPrefix
+	case strings.Contains(imp, query):
+		return scoreSubstring
+	}
+	return fuzzyScore(query, imp)
+}
+
+// fuzzyScore matches if every character of query appears in imp in order.
+// Matches with fewer characters between them score higher.
+func fuzzyScore(query, imp string) int {
+	gaps, start := 0, -1
+	for _, r := range query {
+		idx := strings.IndexRune(imp, r)
+		if idx == -1 {
+			return 0
+		}
+		if start != -1 {
+			gaps += idx
+		}
+		start = idx
+		imp = imp[idx+1:]
+	}
+	score := scoreFuzzyMax - gaps
+	if score < 1 {
+		score = 1
+	}
+	return score
+}
@@ -0,0 +1,58 @@
+package fixme
+
+import (
+	"testing"
+)
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		query, imp string
+		want       int
+	}{
+		{"fixme", "github.com/adamcolton/fixme", scoreExact},
+		{"github.com/adamcolton/fixme", "github.com/adamcolton/fixme", scoreExact},
+		{"fix", "github.com/adamcolton/fixme", scoreNamePrefix},
+		{"github.com/adam", "github.com/adamcolton/fixme", scorePathPrefix},
+		{"adamcolton", "github.com/adamcolton/fixme", scoreElementPrefix},
+		{"colton", "github.com/adamcolton/fixme", scoreSubstring},
+		{"gfx", "github.com/adamcolton/fixme", scoreFuzzyMax - 22},
+		{"xyz", "github.com/adamcolton/fixme", 0},
+	}
+	for _, tt := range tests {
+		if got := matchScore(tt.query, tt.imp); got != tt.want {
+			t.Errorf("matchScore(%q, %q) = %d, want %d", tt.query, tt.imp, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		query, imp string
+		want       int
+	}{
+		// no characters between the matches
+		{"abc", "abc", scoreFuzzyMax},
+		// the characters before the first match don't count
+		{"abc", "xxabc", scoreFuzzyMax},
+		{"abc", "axbxc", scoreFuzzyMax - 2},
+		// out of order
+		{"cba", "abc", 0},
+		// a match is never scored below 1
+		{"az", "a" + string(make([]byte, 100)) + "z", 1},
+	}
+	for _, tt := range tests {
+		if got := fuzzyScore(tt.query, tt.imp); got != tt.want {
+			t.Errorf("fuzzyScore(%q, %q) = %d, want %d", tt.query, tt.imp, got, tt.want)
+		}
+	}
+}
+
+func TestMatchScoreOrder(t *testing.T) {
+	// each kind of match must rank above the next, even with the project bonus
+	order := []int{scoreExact, scoreNamePrefix, scorePathPrefix, scoreElementPrefix, scoreSubstring, scoreFuzzyMax}
+	for i := 1; i < len(order); i++ {
+		if order[i]+scoreInProject >= order[i-1] {
+			t.Errorf("score %d with the project bonus reaches %d", order[i], order[i-1])
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package fixme
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store keeps projects between runs. Records are identified by their ID and
+// List returns them ordered by ID.
+type Store interface {
+	Save(pr ProjectRecord) error
+	Load(id []byte) (ProjectRecord, error)
+	Delete(id []byte) error
+	List() ([]ProjectRecord, error)
+	Close() error
+}
+
+// indexCache is implemented by stores that can also keep the package index,
+// so it doesn't need to be rebuilt from scratch on every start.
+type indexCache interface {
+	loadIndexCache() map[string]indexRecord
+	saveIndexCache(records map[string]indexRecord)
+}
+
+// ErrProjectNotFound is returned by a Store when there is no project with the
+// requested ID.
+var ErrProjectNotFound = errors.New("project not found")
+
+// StoreError is returned when saving or loading projects fails, so it can be
+// told apart from other errors.
+type StoreError struct {
+	Op  string
+	Err error
+}
+
+func (e *StoreError) Error() string {
+	return "could not " + e.Op + ": " + e.Err.Error()
+}
+
+func storeErr(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &StoreError{
+		Op:  op,
+		Err: err,
+	}
+}
+
+var (
+	storeMu sync.Mutex
+	store   Store
+)
+
+// SetStore sets where projects are kept. If it isn't called, a BoltStore at
+// DefaultDBPath is opened the first time they are needed.
+func SetStore(s Store) {
+	storeMu.Lock()
+	store = s
+	storeMu.Unlock()
+}
+
+// currentStore returns the store set with SetStore or opens the default one.
+// If the default store can't be opened, it's tried again next time.
+func currentStore() (Store, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if store == nil {
+		s, err := defaultStore()
+		if err != nil {
+			return nil, storeErr("open project database", err)
+		}
+		store = s
+	}
+	return store, nil
+}
+
+func defaultStore() (Store, error) {
+	return OpenBoltStore(DefaultDBPath())
+}
+
+const dbName = "projects.db"
+
+// DefaultDBPath is fixme/projects.db in $XDG_DATA_HOME, or in ~/.local/share
+// if it isn't set. If there's no database there but there is one left in the
+// home directory by an older fixme, that one is used.
+func DefaultDBPath() string {
+	home := os.Getenv("HOME")
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		if home == "" {
+			return dbName
+		}
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+	path := filepath.Join(dataDir, "fixme", dbName)
+	if _, err := os.Stat(path); os.IsNotExist(err) && home != "" {
+		old := filepath.Join(home, dbName)
+		if _, err := os.Stat(old); err == nil {
+			return old
+		}
+	}
+	return path
+}
+
+func (p *Project) Save() error {
+	var err error
+	p.do(func() {
+		err = p.save()
+	})
+	return err
+}
+
+// save is Save for use on the project's goroutine.
+func (p *Project) save() error {
+	s, err := currentStore()
+	if err != nil {
+		return err
+	}
+	return storeErr("save project", s.Save(p.projectRecord()))
+}
+
+func (p *Project) Delete() error {
+	s, err := currentStore()
+	if err != nil {
+		return err
+	}
+	return storeErr("delete project", s.Delete(p.id))
+}
+
+// Load the project with the given id, or the first project if id is nil. If
+// id is nil and there are no projects a new one is returned.
+func Load(id []byte) (*Project, error) {
+	s, err := currentStore()
+	if err != nil {
+		return nil, err
+	}
+	if id == nil {
+		prs, err := s.List()
+		if err != nil {
+			return nil, storeErr("list projects", err)
+		}
+		if len(prs) == 0 {
+			return NewProject(), nil
+		}
+		id = prs[0].ID
+	}
+	pr, err := s.Load(id)
+	if err != nil {
+		return nil, storeErr("load project", err)
+	}
+	return pr.Project(id), nil
+}
+
+// LoadRecord returns the project with the given id as it's stored, without
+// resolving its packages or starting it.
+func LoadRecord(id []byte) (ProjectRecord, error) {
+	s, err := currentStore()
+	if err != nil {
+		return ProjectRecord{}, err
+	}
+	pr, err := s.Load(id)
+	if err != nil {
+		return ProjectRecord{}, storeErr("load project", err)
+	}
+	pr.ID = id
+	return pr, nil
+}
+
+// List the projects with only their Name and ID.
+func List() ([]ProjectRecord, error) {
+	s, err := currentStore()
+	if err != nil {
+		return nil, err
+	}
+	prs, err := s.List()
+	if err != nil {
+		return nil, storeErr("list projects", err)
+	}
+	projects := make([]ProjectRecord, 0, len(prs))
+	for _, pr := range prs {
+		projects = append(projects, ProjectRecord{
+			Name: pr.Name,
+			ID:   pr.ID,
+		})
+	}
+	return projects, nil
+}
+
+// loadIndexCache returns the cached package index, which is empty if the store
+// can't be opened or doesn't keep the index.
+func loadIndexCache() map[string]indexRecord {
+	s, _ := currentStore()
+	if ic, ok := s.(indexCache); ok {
+		return ic.loadIndexCache()
+	}
+	return make(map[string]indexRecord)
+}
+
+func saveIndexCache(records map[string]indexRecord) {
+	s, _ := currentStore()
+	if ic, ok := s.(indexCache); ok {
+		ic.saveIndexCache(records)
+	}
+}
+
+// storedProject is the format projects are written in by the stores that
+// encode them. Actions are written by name so they don't depend on the order
+// of the constants.
+type storedProject struct {
+	Version   int
+	Name      string
+	ConfigDir string `json:",omitempty"`
+	Pkgs      []storedPackage
+	Patterns  []storedPattern `json:",omitempty"`
+}
+
+type storedPackage struct {
+	Import string
+	Path   string `json:",omitempty"`
+	Action string
+}
+
+type storedPattern struct {
+	Pattern string
+	Action  string
+	Auto    bool     `json:",omitempty"`
+	Exclude []string `json:",omitempty"`
+}
+
+// storedUpgrades bring a storedProject up to date as it's read, the one at i
+// takes a record from version i+1 to i+2. Records without a Version, like the
+// files a DirStore wrote before it was added, are version 1. Add to the end,
+// never change one that has been released.
+var storedUpgrades = []func(sp *storedProject) error{}
+
+var storedVersion = len(storedUpgrades) + 1
+
+// ErrNewerProject is returned when a project was written by a newer fixme.
+var ErrNewerProject = errors.New("the project was written by a newer fixme")
+
+// upgrade brings sp up to storedVersion.
+func (sp *storedProject) upgrade() error {
+	if sp.Version == 0 {
+		sp.Version = 1
+	}
+	if sp.Version > storedVersion {
+		return ErrNewerProject
+	}
+	for ; sp.Version < storedVersion; sp.Version++ {
+		if err := storedUpgrades[sp.Version-1](sp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toStored(pr ProjectRecord) storedProject {
+	sp := storedProject{
+		Version:   storedVersion,
+		Name:      pr.Name,
+		ConfigDir: pr.ConfigDir,
+		Pkgs:      make([]storedPackage, len(pr.Pkgs)),
+		Patterns:  make([]storedPattern, len(pr.Patterns)),
+	}
+	for i, pkg := range pr.Pkgs {
+		sp.Pkgs[i] = storedPackage{
+			Import: pkg.Import,
+			Path:   pkg.Path,
+			Action: pkg.Action.String(),
+		}
+	}
+	for i, pt := range pr.Patterns {
+		sp.Patterns[i] = storedPattern{
+			Pattern: pt.Pattern,
+			Action:  pt.Action.String(),
+			Auto:    pt.Auto,
+			Exclude: pt.Exclude,
+		}
+	}
+	return sp
+}
+
+// record upgrades sp and converts it back to a ProjectRecord. An action that
+// isn't known is an error, rather than quietly dropping the package from the
+// checks.
+func (sp storedProject) record(id []byte) (ProjectRecord, error) {
+	pr := ProjectRecord{
+		ID: id,
+	}
+	if err := sp.upgrade(); err != nil {
+		return pr, err
+	}
+	pr.Name, pr.ConfigDir = sp.Name, sp.ConfigDir
+	for _, pkg := range sp.Pkgs {
+		action, ok := ParseAction(pkg.Action)
+		if !ok {
+			return pr, fmt.Errorf("project %s: unknown action %q for %s", sp.Name, pkg.Action, pkg.Import)
+		}
+		pr.Pkgs = append(pr.Pkgs, PackageRecord{
+			Import: pkg.Import,
+			Path:   pkg.Path,
+			Action: action,
+		})
+	}
+	for _, pt := range sp.Patterns {
+		action, ok := ParseAction(pt.Action)
+		if !ok {
+			return pr, fmt.Errorf("project %s: unknown action %q for pattern %s", sp.Name, pt.Action, pt.Pattern)
+		}
+		pr.Patterns = append(pr.Patterns, Pattern{
+			Pattern: pt.Pattern,
+			Action:  action,
+			Auto:    pt.Auto,
+			Exclude: pt.Exclude,
+		})
+	}
+	return pr, nil
+}
+
+// MemoryStore is a Store that only keeps projects, and the history of their
+// runs, until the program exits.
+type MemoryStore struct {
+	mu       sync.Mutex
+	projects map[string]ProjectRecord
+	history  map[string][]RunRecord // oldest first
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		projects: make(map[string]ProjectRecord),
+		history:  make(map[string][]RunRecord),
+	}
+}
+
+func (s *MemoryStore) Save(pr ProjectRecord) error {
+	s.mu.Lock()
+	s.projects[string(pr.ID)] = pr
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) Load(id []byte) (ProjectRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr, ok := s.projects[string(id)]
+	if !ok {
+		return pr, ErrProjectNotFound
+	}
+	return pr, nil
+}
+
+func (s *MemoryStore) Delete(id []byte) error {
+	s.mu.Lock()
+	delete(s.projects, string(id))
+	delete(s.history, string(id))
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) List() ([]ProjectRecord, error) {
+	s.mu.Lock()
+	prs := make([]ProjectRecord, 0, len(s.projects))
+	for _, pr := range s.projects {
+		prs = append(prs, pr)
+	}
+	s.mu.Unlock()
+	sortRecords(prs)
+	return prs, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) saveRun(project []byte, rec *RunRecord, keep Retention) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := s.history[string(project)]
+	var last uint64
+	if len(runs) > 0 {
+		last = runs[len(runs)-1].ID
+	}
+	rec.ID = runID(rec.Start, last)
+	runs = append(runs, *rec)
+	now := time.Now()
+	for len(runs) > 0 && ((keep.Runs > 0 && len(runs) > keep.Runs) || keep.expired(runs[0].ID, now)) {
+		runs = runs[1:]
+	}
+	s.history[string(project)] = runs
+	return nil
+}
+
+func (s *MemoryStore) runs(project []byte, limit int) ([]RunRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := s.history[string(project)]
+	runs := make([]RunRecord, 0)
+	for i := len(all) - 1; i >= 0 && (limit <= 0 || len(runs) < limit); i-- {
+		runs = append(runs, all[i].summary())
+	}
+	return runs, nil
+}
+
+func (s *MemoryStore) run(project []byte, id uint64) (RunRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rec := range s.history[string(project)] {
+		if rec.ID == id {
+			return rec, nil
+		}
+	}
+	return RunRecord{}, ErrRunNotFound
+}
+
+func sortRecords(prs []ProjectRecord) {
+	sort.Slice(prs, func(i, j int) bool {
+		return string(prs[i].ID) < string(prs[j].ID)
+	})
+}
@@ -0,0 +1,69 @@
+package fixme
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStoredProjectRecord(t *testing.T) {
+	pr := ProjectRecord{
+		Name: "p",
+		ID:   []byte("id"),
+		Pkgs: []PackageRecord{
+			{Import: "example.com/a", Path: "/src/a", Action: Lint},
+			{Import: "example.com/b", Action: Watch},
+		},
+		Patterns: []Pattern{
+			{Pattern: "/src/...", Action: Test, Auto: true, Exclude: []string{"example.com/c"}},
+		},
+	}
+	got, err := toStored(pr).record(pr.ID)
+	if err != nil || !reflect.DeepEqual(got, pr) {
+		t.Errorf("got %+v, %v, want %+v", got, err, pr)
+	}
+
+	sp := toStored(pr)
+	sp.Pkgs[1].Action = "bench"
+	if _, err := sp.record(pr.ID); err == nil {
+		t.Error("package with an unknown action loaded")
+	}
+	sp = toStored(pr)
+	sp.Patterns[0].Action = ""
+	if _, err := sp.record(pr.ID); err == nil {
+		t.Error("pattern with an unknown action loaded")
+	}
+}
+
+func TestDecodeDirProject(t *testing.T) {
+	pr, err := decodeDirProject([]byte("id"), []byte(`{"Name":"p","Pkgs":[{"Import":"example.com/a","Action":"test"}]}`))
+	if err != nil || len(pr.Pkgs) != 1 || pr.Pkgs[0].Action != Test {
+		t.Errorf("got %+v, %v", pr, err)
+	}
+	if _, err := decodeDirProject([]byte("id"), []byte(`{"Name":"p","Pkgs":[{"Import":"example.com/a","Action":"tset"}]}`)); err == nil {
+		t.Error("package with an unknown action loaded")
+	}
+}
+
+func TestLoadRecord(t *testing.T) {
+	s, err := currentStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// packages that can't be found are kept as they are
+	pr := ProjectRecord{
+		Name: "record",
+		ID:   []byte("load-record"),
+		Pkgs: []PackageRecord{{Import: "example.com/nowhere/a", Path: "/nowhere/a", Action: Test}},
+	}
+	if err := s.Save(pr); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Delete(pr.ID)
+	got, err := LoadRecord(pr.ID)
+	if err != nil || got.Name != pr.Name || !reflect.DeepEqual(got.Pkgs, pr.Pkgs) {
+		t.Errorf("got %+v, %v", got, err)
+	}
+	if _, err := LoadRecord([]byte("no-such-project")); err == nil {
+		t.Error("loaded a project that doesn't exist")
+	}
+}
@@ -20,6 +20,13 @@ $(function(){
   UI.brand = $("#brand");
   UI.packagesBody = $("#packages-body");
   UI.projectsMenu = $("#projects + ul")
+  UI.pattern = $("#pattern");
+  $("#pattern-options").html([
+    '<input type="radio" name="pattern_action" value="watch"/> Watch ',
+    '<input type="radio" name="pattern_action" value="test" checked="checked"/> Test ',
+    '<input type="radio" name="pattern_action" value="lint"/> Lint ',
+    '<label><input type="checkbox" id="pattern-auto"/> Add new packages automatically</label>'
+  ].join(""));
 
   var mainPanel = $("#main-heading").parent();
   var mainPanelClass = "panel-default"
@@ -35,6 +42,11 @@ $(function(){
   var toggleState = "main";
   editPanels.hide();
   var toggle = $("#toggle");
+  UI.showMain = function(){
+    if (toggleState == "edit") {
+      toggle.click();
+    }
+  };
   toggle.click(function(){
     if (toggleState == "edit") {
       toggleState = "main";
@@ -52,11 +64,71 @@ $(function(){
   $("#new-project").click(function(){
     Comm.newProject();
   });
+
+  $(UI.mainBody).on("click", "li.diagnostic a[data-line]", function(){
+    var link = $(this);
+    var file = link.closest("li.diagnostic").attr("data-file");
+    Comm.openEditor(file, link.attr("data-line"), link.attr("data-col") || 0);
+  });
+
+  $("#rerun").click(function(){
+    Comm.rerun();
+  });
+
+  UI.pause = $("#pause");
+  UI.pause.click(function(){
+    Comm.togglePause();
+  });
+
+  $(UI.mainHeading).on("click", "a.rerun-package", function(){
+    Comm.rerun($(this).attr("data-package"));
+  });
+
+  $("#history").click(function(){
+    Comm.history();
+  });
+
+  $(UI.mainBody).on("click", "tr.past-run[data-run]", function(){
+    Comm.pastRun($(this).attr("data-run"));
+  });
+
+  $("#rescan").click(function(){
+    Comm.rescan();
+  });
+
+  $("#export-project").click(function(){
+    window.location = "/export?id=" + encodeURIComponent(Project.Active.ID);
+  });
+
+  var importFile = $('<input type="file" accept=".json,.yaml,.yml" style="display:none"/>');
+  $(document.body).append(importFile);
+  importFile.change(function(){
+    var file = this.files[0];
+    if (!file){
+      return;
+    }
+    var reader = new FileReader();
+    reader.onload = function(){
+      Comm.importProject(file.name, reader.result);
+    };
+    reader.readAsText(file);
+    this.value = "";
+  });
+  $("#import-project").click(function(){
+    importFile.click();
+  });
+
+  $("#new-project-dir").click(function(){
+    var dir = prompt("Folder or go.mod to create the project from");
+    if (dir) {
+      Comm.newProjectFromDir(dir);
+    }
+  });
 });
 
 var Comm = (function(){
-  function timeStr(){
-    var t = new Date();
+  function timeStr(t){
+    t = t || new Date();
     var h = t.getHours();
     if (h<10){
       h = "0" + h
@@ -77,10 +149,182 @@ var Comm = (function(){
     "Build": "danger",
     "Test": "warning",
   };
+  // escape makes str safe to put in html, including in attributes
+  var escape = function(str){
+    return $("<div/>").text(str).html().replace(/"/g, "&quot;").replace(/'/g, "&#39;");
+  };
+  var diagnosticItem = function(d){
+    var loc = d.File + ":" + d.Line;
+    if (d.Column > 0){
+      loc += ":" + d.Column;
+    }
+    return [
+      '<li class="diagnostic ',d.Severity,'" data-file="',escape(d.File),'">',
+      '<span class="tool">',d.Tool,'</span> ',
+      '<a class="location" data-line="',d.Line,'" data-col="',d.Column,'">',escape(loc),'</a>',
+      '<pre>',escape(d.Message),'</pre>',
+      sourceContext(d.Context),
+      '</li>'
+    ].join("");
+  };
+  var sourceContext = function(lines){
+    if (!lines || lines.length === 0){
+      return "";
+    }
+    var html = ['<pre class="source">'];
+    var i, l;
+    for (i=0;i<lines.length;i++){
+      l = lines[i];
+      html.push(
+        '<a data-line="', l.Line, '"', l.Highlight ? ' class="highlight">' : '>',
+        '<span class="lineno">', l.Line, '</span>', escape(l.Text), '</a>\n'
+      );
+    }
+    html.push('</pre>');
+    return html.join("");
+  };
   var outputHandler = function(msg){
+    showOutput(msg, timeStr(), blocked);
+  };
+
+  // showOutput shows the result of a run, the heading starts with when.
+  var showOutput = function(msg, when, blocked){
+    liveOutput = null;
+    progressBar = null;
     UI.setMainPanelClass(classMap[msg.Type]);
-    UI.mainBody.innerHTML = msg.Data;
-    UI.mainHeading.innerHTML = timeStr()+") "+msg.Type +" : "+ msg.Package;
+    var ds = msg.Diagnostics || [];
+    var html = [];
+    var i;
+    if (ds.length > 0){
+      html.push('<ul class="diagnostics">');
+      for (i=0;i<ds.length;i++){
+        html.push(diagnosticItem(ds[i]));
+      }
+      html.push('</ul><a class="raw-toggle" onclick="$(this).next().toggle()">Full output</a>');
+      html.push('<pre class="raw" style="display:none">', escape(msg.Data), '</pre>');
+    } else {
+      html.push('<pre class="raw">', escape(msg.Data), '</pre>');
+    }
+    if (blocked.length > 0){
+      html.push('<p class="blocked">Blocked: ', escape(blocked.join(", ")), '</p>');
+    }
+    UI.mainBody.innerHTML = html.join("");
+    UI.mainHeading.innerHTML = when+") "+msg.Type +" : "+ msg.Package;
+    if (msg.Type !== "OK"){
+      UI.mainHeading.innerHTML += ' <a class="rerun-package" data-package="'+escape(msg.Package)+'">rerun package</a>';
+    }
+  };
+
+  // progress follows the events of a run, showing which package and step is
+  // running, the output of the step and a progress bar.
+  var stepNames = {
+    "build": "building",
+    "test": "testing",
+    "lint": "linting",
+  };
+  var liveOutput = null;
+  var progressBar = null;
+  var blocked = [];
+  var progress = function(msg){
+    var pr = JSON.parse(msg.Data);
+    switch (pr.Kind){
+    case "run_started":
+      blocked = [];
+      UI.setMainPanelClass("default");
+      UI.mainHeading.innerHTML = timeStr()+") Running" + (pr.Trigger ? " : " + escape(pr.Trigger) : "");
+      UI.mainBody.innerHTML = '<div class="progress"><div class="progress-bar" style="width:0%"></div></div><pre class="raw live"></pre>';
+      progressBar = $(UI.mainBody).find(".progress-bar");
+      liveOutput = $(UI.mainBody).find("pre.live")[0];
+      break;
+    case "step_started":
+      if (liveOutput === null){
+        return;
+      }
+      progressBar.css("width", pr.Percent + "%");
+      UI.mainHeading.innerHTML = timeStr()+") "+stepNames[pr.Step]+" "+pr.Package+" ("+pr.Index+"/"+pr.Total+")";
+      liveOutput.innerHTML = "";
+      break;
+    case "step_output":
+      if (liveOutput !== null){
+        liveOutput.appendChild(document.createTextNode(pr.Line + "\n"));
+      }
+      break;
+    case "package_blocked":
+      blocked.push(pr.Package);
+      break;
+    case "run_finished":
+      if (progressBar !== null){
+        progressBar.css("width", "100%");
+      }
+      break;
+    }
+  };
+
+  // history lists past runs, they can be opened to see their output and steps
+  // again.
+  var duration = function(ns){
+    return (ns / 1e9).toFixed(1) + "s";
+  };
+  var runTime = function(run){
+    var t = new Date(run.Start);
+    return t.toLocaleDateString() + " " + timeStr(t);
+  };
+  var history = function(msg){
+    var runs = JSON.parse(msg.Data);
+    var html = ['<table class="table table-condensed history">'];
+    var i, run;
+    liveOutput = null;
+    progressBar = null;
+    UI.showMain();
+    UI.setMainPanelClass("default");
+    UI.mainHeading.innerHTML = "History";
+    if (runs.length === 0){
+      UI.mainBody.innerHTML = "No runs yet";
+      return;
+    }
+    for (i=0;i<runs.length;i++){
+      run = runs[i];
+      html.push(
+        '<tr class="past-run" data-run="'+run.ID+'">',
+        '<td>', runTime(run), '</td>',
+        '<td><span class="label label-', classMap[run.State] || "default", '">', escape(run.State), '</span></td>',
+        '<td>', escape(run.Failed || run.Only || ""), '</td>',
+        '<td>', escape(run.Trigger || ""), '</td>',
+        '<td>', duration(run.Duration), '</td>',
+        '</tr>'
+      );
+    }
+    html.push('</table>');
+    UI.mainBody.innerHTML = html.join("");
+  };
+  var stepsTable = function(steps){
+    if (!steps || steps.length === 0){
+      return "";
+    }
+    var html = ['<table class="table table-condensed steps">'];
+    var i, step;
+    for (i=0;i<steps.length;i++){
+      step = steps[i];
+      html.push(
+        step.Failed ? '<tr class="danger">' : '<tr>',
+        '<td>', escape(step.Step), '</td>',
+        '<td>', escape(step.Package), '</td>',
+        '<td>', duration(step.Duration), '</td>',
+        '</tr>'
+      );
+    }
+    html.push('</table>');
+    return html.join("");
+  };
+  var pastRun = function(msg){
+    var run = JSON.parse(msg.Data);
+    showOutput({
+      Type: run.State,
+      Package: run.Failed || "nothing to report",
+      Data: run.Output,
+      Diagnostics: run.Diagnostics,
+    }, "History " + runTime(run), []);
+    UI.mainBody.innerHTML += stepsTable(run.Steps);
   };
 
   var showPackagesWithName = function(msg){
@@ -111,6 +355,9 @@ var Comm = (function(){
     if (msg.Type == "new_project"){
       UI.addProject(projData.Name, projData.ID);
     }
+    if (msg.Missing && msg.Missing.length > 0){
+      alert("Could not find these packages:\n" + msg.Missing.join("\n"));
+    }
   }
 
   var listProjects = function(msg){
@@ -122,6 +369,18 @@ var Comm = (function(){
     }
   }
 
+  // storeError shows that projects couldn't be saved or loaded. Changes still
+  // apply until the page is closed, so it stays up until it's dismissed
+  // rather than interrupting with an alert.
+  var storeError = function(msg){
+    var banner = $("#store-error");
+    if (banner.length === 0){
+      banner = $('<div id="store-error" class="alert alert-danger"><a class="close" onclick="$(this).parent().remove()">&times;</a><span></span></div>');
+      $(document.body).prepend(banner);
+    }
+    banner.find("span").text(msg.Data);
+  };
+
   var msgHandlers = {
     "OK": outputHandler,
     "Lint":outputHandler,
@@ -131,8 +390,27 @@ var Comm = (function(){
     "load": loadProject,
     "new_project": loadProject,
     "list": listProjects,
+    "progress": progress,
+    "history": history,
+    "past_run": pastRun,
+    "paused": function(){
+      paused = true;
+      UI.pause.html("Resume");
+    },
+    "resumed": function(){
+      paused = false;
+      UI.pause.html("Pause");
+    },
+    "rescan": function(msg){
+      UI.pkgnameResults.innerHTML = "Rescanning packages...";
+    },
+    "error": function(msg){
+      alert(msg.Data);
+    },
+    "store_error": storeError,
   };
 
+  var paused = false;
   var conn = new WebSocket("ws://"+window.location.host+"/ws");
   conn.onmessage = function(rawMsg){
     var msg = JSON.parse(rawMsg.data);
@@ -173,9 +451,40 @@ var Comm = (function(){
       send("set_name",UI.projname.val());
       return false; 
     },
+    "addPattern": function(){
+      var action = $("input[name=pattern_action]:checked").val();
+      var type = $("#pattern-auto").is(":checked") ? "auto_pattern" : "add_pattern";
+      send(type, action, UI.pattern.val());
+      UI.pattern.val("");
+      return false;
+    },
     "newProject": function(){
       send("new_project");
     },
+    "rescan": function(){
+      send("rescan");
+    },
+    "history": function(){
+      send("history");
+    },
+    "pastRun": function(id){
+      send("past_run", id);
+    },
+    "rerun": function(pkg){
+      send("rerun", "", pkg || "");
+    },
+    "togglePause": function(){
+      send(paused ? "resume" : "pause");
+    },
+    "openEditor": function(file, line, col){
+      send("open_editor", line + ":" + col, file);
+    },
+    "newProjectFromDir": function(dir){
+      send("new_project_dir", dir);
+    },
+    "importProject": function(name, data){
+      send("import_project", data, name);
+    },
     "deletePackage":function(){
       document.getElementById(Project.Active.ID).parentElement.remove();
       send("delete_project");
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/adamcolton/fixme/fixme"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// lsp runs a minimal Language Server Protocol server on stdin and stdout. It
+// doesn't provide any language features, it only publishes the diagnostics
+// for the project's current failure. The project is picked by name from the
+// args, or by the module at the workspace root. A project for the module is
+// created if there isn't one.
+func lsp(args []string) {
+	s := &lspServer{
+		in:  bufio.NewReader(os.Stdin),
+		out: os.Stdout,
+	}
+	// anything else printed to stdout would corrupt the protocol
+	os.Stdout = os.Stderr
+	if len(args) > 0 {
+		s.name = args[0]
+	}
+	if err := s.serve(); err != nil && err != io.EOF {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+type lspServer struct {
+	in        *bufio.Reader
+	out       io.Writer
+	outMux    sync.Mutex
+	name      string
+	root      string
+	proj      *fixme.Project
+	published map[string]bool
+}
+
+type lspRequest struct {
+	ID     *json.RawMessage `json:"id"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params"`
+}
+
+type lspResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+}
+
+type lspErrorResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   *lspError        `json:"error"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type publishDiagnosticsParams struct {
+	URI         string          `json:"uri"`
+	Diagnostics []lspDiagnostic `json:"diagnostics"`
+}
+
+const lspMethodNotFound = -32601
+
+func (s *lspServer) serve() error {
+	for {
+		req, err := s.read()
+		if err != nil {
+			return err
+		}
+		switch req.Method {
+		case "initialize":
+			var params struct {
+				RootURI string `json:"rootUri"`
+			}
+			json.Unmarshal(req.Params, &params)
+			if u, err := url.Parse(params.RootURI); err == nil {
+				s.root = u.Path
+			}
+			s.respond(req.ID, map[string]interface{}{
+				"capabilities": map[string]interface{}{},
+				"serverInfo": map[string]string{
+					"name": "fixme",
+				},
+			}, nil)
+		case "initialized":
+			if err := s.start(); err != nil {
+				s.notify("window/showMessage", map[string]interface{}{
+					"type":    1,
+					"message": "fixme: " + err.Error(),
+				})
+			}
+		case "shutdown":
+			s.respond(req.ID, nil, nil)
+		case "exit":
+			return nil
+		default:
+			// notifications we don't handle are ignored, requests get an
+			// error
+			if req.ID != nil {
+				s.respond(req.ID, nil, &lspError{
+					Code:    lspMethodNotFound,
+					Message: "method not supported: " + req.Method,
+				})
+			}
+		}
+	}
+}
+
+// start finds the project and starts running it, publishing each update.
+func (s *lspServer) start() error {
+	proj, err := s.findProject()
+	if err != nil {
+		return err
+	}
+	s.proj = proj
+	s.published = make(map[string]bool)
+	go func() {
+		for {
+			select {
+			case pkg := <-proj.Update:
+				s.publish(pkg)
+			case <-proj.Progress:
+				// only results are published, but progress has to be read
+				// for them to be sent
+			}
+		}
+	}()
+	proj.ResolveDependancies()
+	return proj.Run()
+}
+
+func (s *lspServer) findProject() (*fixme.Project, error) {
+	name := s.name
+	if name == "" {
+		if s.root == "" {
+			return nil, fmt.Errorf("no project given and no workspace root")
+		}
+		_, mod, err := fixme.ModuleRoot(s.root)
+		if err != nil {
+			return nil, err
+		}
+		name = mod
+	}
+	list, err := fixme.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, pr := range list {
+		if pr.Name == name {
+			return fixme.Load(pr.ID)
+		}
+	}
+	if s.name != "" {
+		return nil, fmt.Errorf("no project named %q", s.name)
+	}
+	return fixme.NewProjectFromDir(s.root)
+}
+
+// publish sends the diagnostics for the failing package, grouped by file.
+// Files that had diagnostics before and no longer do are cleared.
+func (s *lspServer) publish(pkg *fixme.Package) {
+	byFile := make(map[string][]lspDiagnostic)
+	if pkg != nil {
+		for _, d := range pkg.Diagnostics {
+			byFile[d.File] = append(byFile[d.File], toLSPDiagnostic(d))
+		}
+	}
+	for file := range s.published {
+		if _, ok := byFile[file]; !ok {
+			byFile[file] = []lspDiagnostic{}
+		}
+	}
+	s.published = make(map[string]bool)
+	for file, ds := range byFile {
+		if len(ds) > 0 {
+			s.published[file] = true
+		}
+		s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         (&url.URL{Scheme: "file", Path: file}).String(),
+			Diagnostics: ds,
+		})
+	}
+}
+
+func toLSPDiagnostic(d fixme.Diagnostic) lspDiagnostic {
+	pos := lspPosition{
+		Line: d.Line - 1,
+	}
+	if d.Column > 0 {
+		pos.Character = d.Column - 1
+	}
+	severity := 1
+	if d.Severity == fixme.SeverityWarning {
+		severity = 2
+	}
+	return lspDiagnostic{
+		Range: lspRange{
+			Start: pos,
+			End:   pos,
+		},
+		Severity: severity,
+		Source:   "fixme " + d.Tool,
+		Message:  d.Message,
+	}
+}
+
+func (s *lspServer) read() (*lspRequest, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(strings.ToLower(line), "content-length:") {
+			length, err = strconv.Atoi(strings.TrimSpace(line[len("content-length:"):]))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	req := &lspRequest{}
+	return req, json.Unmarshal(body, req)
+}
+
+func (s *lspServer) respond(id *json.RawMessage, result interface{}, err *lspError) {
+	if err != nil {
+		s.write(lspErrorResponse{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error:   err,
+		})
+		return
+	}
+	s.write(lspResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  result,
+	})
+}
+
+func (s *lspServer) notify(method string, params interface{}) {
+	s.write(lspNotification{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+}
+
+func (s *lspServer) write(msg interface{}) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	s.outMux.Lock()
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(b))
+	s.out.Write(b)
+	s.outMux.Unlock()
+}
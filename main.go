@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -13,17 +15,61 @@ import (
 	"github.com/adamcolton/gothic/bufpool"
 	"github.com/adamcolton/socketServer"
 	"github.com/gorilla/websocket"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
 	mainHtmlBuf []byte
 	port        = flag.String("port", ":6060", "port to run server")
+	errorFile   = flag.String("errorfile", "", "file to write the current failure to in file:line:col: message format")
+	errorAll    = flag.Bool("errorfile-all", false, "write every diagnostic of the current failure to the errorfile, not just the first")
+	editor      = flag.String("editor", "", "command to open files with, {file}, {line} and {col} are replaced (defaults to $VISUAL or $EDITOR)")
+	workerAddr  = flag.String("worker", "", "host:port of a fixme worker to run builds and tests on")
+	workerRoot  = flag.String("worker-root", "", "local directory that matches the worker's -root")
+	storeDir    = flag.String("store-dir", "", "keep projects as JSON files in this directory instead of the database")
+	dbPath      = flag.String("db", "", "database to keep projects in (defaults to $XDG_DATA_HOME/fixme/projects.db)")
+	server      = flag.String("server", "localhost:6060", "web fixme whose projects the commands use when it's running, and others use when the database is in use")
+	client      = flag.Bool("client", false, "always use the projects of the fixme at -server instead of opening the database")
+	historyRuns = flag.Int("history", fixme.HistoryRetention.Runs, "number of runs to keep in each project's history, 0 keeps all")
+	historyDays = flag.Int("history-days", int(fixme.HistoryRetention.Age/(24*time.Hour)), "days to keep runs in each project's history, 0 keeps them until there are too many")
 )
 
 func main() {
 	flag.Parse()
+	fixme.ErrorFile = *errorFile
+	fixme.ErrorFileAll = *errorAll
+	fixme.HistoryRetention = fixme.Retention{
+		Runs: *historyRuns,
+		Age:  time.Duration(*historyDays) * 24 * time.Hour,
+	}
+	if *workerAddr != "" {
+		fixme.DefaultRunner = &fixme.RemoteRunner{
+			Addr: *workerAddr,
+			Root: *workerRoot,
+		}
+	}
+	cmd, isCmd := commands[flag.Arg(0)]
+	var store fixme.Store
+	var storeToken string
+	if !isCmd || flag.Arg(0) != "worker" {
+		var err error
+		if store, storeToken, err = openStore(!isCmd); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fixme.SetStore(store)
+		defer store.Close()
+	}
+	if isCmd {
+		cmd(flag.Args()[1:])
+		return
+	}
 	populateMainHtmlBuf()
 
 	s := socketServer.New()
@@ -39,12 +85,92 @@ func main() {
 	})
 
 	s.HandleWebsocket("/ws", proj)
+	if storeToken != "" {
+		s.HandleFunc(fixme.StorePath, fixme.StoreHandler(store, storeToken, reloadProject).ServeHTTP)
+	}
+	s.HandleFunc("/export", exportHandler)
 
 	err := s.ListenAndServe(*port)
 	println(err.Error())
 
 }
 
+// openStore opens where projects are kept based on the flags. Only the web
+// server, serve, shares the database with other fixmes, so it's the only one
+// that writes a token for them to send. The commands use the projects of the
+// fixme at -server if it's running and only open the database themselves if
+// it isn't, so a web server started later can still get it. If the database
+// is in use, the web server uses the projects of the fixme that has it, which
+// has to be serving them.
+func openStore(serve bool) (fixme.Store, string, error) {
+	if *storeDir != "" {
+		s, err := fixme.OpenDirStore(*storeDir)
+		return s, "", err
+	}
+	path := *dbPath
+	if path == "" {
+		path = fixme.DefaultDBPath()
+	}
+	if *client {
+		return remoteStore(path), "", nil
+	}
+	if !serve {
+		if r := remoteStore(path); serving(r) {
+			return r, "", nil
+		}
+	}
+	s, err := fixme.OpenBoltStore(path)
+	if err == fixme.ErrStoreLocked {
+		r := remoteStore(path)
+		if !serve || !serving(r) {
+			return nil, "", fmt.Errorf("%s is in use by a fixme that isn't serving its projects at %s", path, *server)
+		}
+		if samePort(*server, *port) {
+			return nil, "", fmt.Errorf("the fixme at %s is using -port %s, start this one with another -port", *server, *port)
+		}
+		// stderr so this doesn't end up in the lsp's protocol
+		fmt.Fprintln(os.Stderr, path, "is in use, using the projects of the fixme at", *server)
+		return r, "", nil
+	}
+	if err != nil || !serve {
+		return s, "", err
+	}
+	token, err := fixme.NewStoreToken(fixme.StoreTokenPath(path))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Other fixmes can't use the projects:", err)
+	}
+	return s, token, nil
+}
+
+// remoteStore uses the projects of the fixme at -server, with the token it
+// wrote next to the database at path.
+func remoteStore(path string) *fixme.RemoteStore {
+	token, err := fixme.ReadStoreToken(fixme.StoreTokenPath(path))
+	if err != nil && *client {
+		fmt.Fprintln(os.Stderr, "No token for the fixme at", *server, ":", err)
+	}
+	return &fixme.RemoteStore{
+		Addr:  *server,
+		Token: token,
+	}
+}
+
+// serving reports whether the fixme at r's address is serving its projects.
+func serving(r *fixme.RemoteStore) bool {
+	if r.Token == "" {
+		return false
+	}
+	_, err := r.List()
+	return err == nil
+}
+
+// samePort reports whether the host:port addresses a and b use the same port.
+func samePort(a, b string) bool {
+	_, pa, errA := net.SplitHostPort(a)
+	_, pb, errB := net.SplitHostPort(b)
+	return errA == nil && errB == nil && pa == pb
+}
+
 func populateMainHtmlBuf() {
 	panelBody := query.MustSelector(".panel-body")
 	panelHeading := query.MustSelector(".panel-heading")
@@ -53,8 +179,18 @@ func populateMainHtmlBuf() {
 	bundle := bootstrap3bundle.New("Test UI")
 	projects := bundle.Nav.Add(bootstrap3.Right, "projects", "Projects", "")
 	projects.Sub("new-project", "New Project", "plus", "")
+	projects.Sub("new-project-dir", "New Project from Folder", "folder-open", "")
+	projects.Sub("import-project", "Import Project", "import", "")
+	projects.Sub("export-project", "Export Project", "export", "")
 	projects.Divider()
 	bundle.Nav.Add(bootstrap3.Left, "toggle", "Edit", "")
+	bundle.Nav.Add(bootstrap3.Left, "rescan", "Rescan Packages", "")
+	bundle.Nav.Add(bootstrap3.Left, "rerun", "Rerun", "")
+	bundle.Nav.Add(bootstrap3.Left, "pause", "Pause", "")
+	// only the database keeps the history of runs
+	if fixme.KeepsHistory() {
+		bundle.Nav.Add(bootstrap3.Left, "history", "History", "")
+	}
 	bundle.AddScripts("/fixme.js")
 	bundle.AddCSS("/main.css")
 	bundle.FormStyle.Inline = true
@@ -62,9 +198,9 @@ func populateMainHtmlBuf() {
 
 	d := bundle.Document()
 
-	pre := html.NewTag("pre")
-	pre.AddAttributes("id", "main-body")
-	main := bundle.SinglePanel("Loading...", pre).Render()
+	body := html.NewTag("div")
+	body.AddAttributes("id", "main-body")
+	main := bundle.SinglePanel("Loading...", body).Render()
 	main.(html.TagNode).AddAttributes("id", "main-panel")
 
 	panelHeading.Query(main).AddAttributes("id", "main-heading")
@@ -82,7 +218,13 @@ func populateMainHtmlBuf() {
 
 	listPkgs := html.NewTag("div", "id", "pkgname-results")
 
-	f := html.NewFragment(projNameHtml, packageSearchHtml, listPkgs)
+	addPattern := bundle.Form()
+	addPattern.InputTag("text", "Add Pattern (github.com/org/repo/... or a directory)", "pattern")
+	addPatternHtml := addPattern.Render().(html.TagNode)
+	addPatternHtml.AddAttributes("onsubmit", "return Comm.addPattern()")
+	patternOptions := html.NewTag("div", "id", "pattern-options")
+
+	f := html.NewFragment(projNameHtml, packageSearchHtml, listPkgs, addPatternHtml, patternOptions)
 	edit := bundle.SinglePanel("Edit", f).Render().(html.TagNode)
 	edit.AddAttributes("id", "edit-panel")
 	edit.AppendClass("edit")
@@ -107,17 +249,82 @@ func populateMainHtmlBuf() {
 }
 
 type WSMessage struct {
-	Type    string
-	Package string
-	Data    string
-	ID      []byte
+	Type        string
+	Package     string
+	Data        string
+	ID          []byte
+	Diagnostics []fixme.Diagnostic
+	Missing     []string
+}
+
+// session is the state of one websocket connection. Handlers run on the
+// goroutine reading the socket, or on the store handler's when another fixme
+// changes the project, holding mu; when they switch projects the goroutine
+// writing to the socket is told on swap so it follows the new project's
+// updates.
+type session struct {
+	mu     sync.Mutex
+	proj   *fixme.Project
+	swap   chan *fixme.Project
+	write  chan []byte
+	closed bool
+}
+
+// sessions are the open websocket connections.
+var sessions = struct {
+	sync.Mutex
+	m map[*session]bool
+}{
+	m: make(map[*session]bool),
+}
+
+// reloadProject is called when another fixme saves or deletes the project
+// with the id, the sessions showing it load it again. If it was deleted they
+// load the first project, as they do when it's deleted in the UI.
+func reloadProject(id []byte) {
+	sessions.Lock()
+	var open []*session
+	for s := range sessions.m {
+		open = append(open, s)
+	}
+	sessions.Unlock()
+
+	for _, s := range open {
+		s.mu.Lock()
+		if !s.closed && bytes.Equal(s.proj.ProjectRecord().ID, id) {
+			msg := loadProject(WSMessage{ID: id}, s)
+			if msg.Type != "load" {
+				msg = loadProject(WSMessage{}, s)
+			}
+			b, _ := json.Marshal(msg)
+			s.write <- b
+		}
+		s.mu.Unlock()
+	}
+}
+
+// setProject closes the current project and replaces it with p.
+func (s *session) setProject(p *fixme.Project) {
+	s.proj.Close()
+	s.proj = p
+	s.swap <- p
 }
 
 func proj(r *http.Request, socket *websocket.Conn) {
 	close := make(chan bool)
 	write := make(chan []byte, 10)
+	s := &session{
+		swap:  make(chan *fixme.Project),
+		write: write,
+	}
 
-	list := fixme.List()
+	// if the projects can't be loaded, the UI still works with an unsaved
+	// project and shows the error
+	list, err := fixme.List()
+	if err != nil {
+		b, _ := json.Marshal(errorMsg(err))
+		write <- b
+	}
 	listData, _ := json.Marshal(list)
 	listMsg, _ := json.Marshal(WSMessage{
 		Type: "list",
@@ -127,17 +334,25 @@ func proj(r *http.Request, socket *websocket.Conn) {
 
 	var projMsg WSMessage
 	var proj *fixme.Project
-	if len(list) == 0 {
+	if len(list) > 0 {
+		proj, err = fixme.Load(list[0].ID)
+		projMsg.Type = "load"
+	}
+	if proj == nil {
 		proj = fixme.NewProject()
-		proj.Save()
+		if err == nil {
+			err = proj.Save()
+		}
 		projMsg.Type = "new_project"
-	} else {
-		proj = fixme.Load(list[0].ID)
-		projMsg.Type = "load"
+	}
+	if err != nil {
+		b, _ := json.Marshal(errorMsg(err))
+		write <- b
 	}
 	projMsg.Data = string(proj.JSON())
 	b, _ := json.Marshal(projMsg)
 	write <- b
+	s.proj = proj
 
 	go func() {
 		for {
@@ -145,18 +360,28 @@ func proj(r *http.Request, socket *websocket.Conn) {
 			case msg := <-write:
 				socket.WriteMessage(1, msg)
 			case p := <-proj.Update:
+				// progress still in the buffer happened before the update
+				for len(proj.Progress) > 0 {
+					sendProgress(socket, <-proj.Progress)
+				}
 				var msg WSMessage
 				if p != nil {
 					msg.Type = p.State().String()
 					msg.Package = p.Import
 					msg.Data = p.Data
+					msg.Diagnostics = p.Diagnostics
 				} else {
 					msg.Type = "OK"
 					msg.Package = "nothing to report"
 					msg.Data = "Good job, buddy!"
 				}
+				// this goroutine is the one reading write, so write to the
+				// socket directly instead of risking filling the buffer
 				b, _ := json.Marshal(msg)
-				write <- b
+				socket.WriteMessage(1, b)
+			case pr := <-proj.Progress:
+				sendProgress(socket, pr)
+			case proj = <-s.swap:
 			case <-close:
 				return
 			}
@@ -165,32 +390,81 @@ func proj(r *http.Request, socket *websocket.Conn) {
 
 	proj.ResolveDependancies()
 	proj.Run()
+	sessions.Lock()
+	sessions.m[s] = true
+	sessions.Unlock()
 
 	for data := range socketServer.ReadSocket(socket, 0) {
 		var msg WSMessage
 		json.Unmarshal(data, &msg)
 		if h, ok := handlers[msg.Type]; ok {
-			b, _ := json.Marshal(h(msg, proj))
+			s.mu.Lock()
+			reply := h(msg, s)
+			s.mu.Unlock()
+			b, _ := json.Marshal(reply)
 			write <- b
 		} else {
 			fmt.Println("Unknown:", msg)
 		}
 	}
 
-	proj.Close()
+	sessions.Lock()
+	delete(sessions.m, s)
+	sessions.Unlock()
+	s.mu.Lock()
+	s.closed = true
+	s.proj.Close()
+	s.mu.Unlock()
+	close <- true
 }
 
-var handlers = map[string]func(WSMessage, *fixme.Project) WSMessage{
-	"package_name":   getPackagesByName,
-	"set_name":       setProjectName,
-	"package_state":  setPackageState,
-	"new_project":    newProject,
-	"load_project":   loadProject,
-	"delete_project": deleteProject,
+func sendProgress(socket *websocket.Conn, pr fixme.Progress) {
+	data, _ := json.Marshal(pr)
+	b, _ := json.Marshal(WSMessage{
+		Type: "progress",
+		Data: string(data),
+	})
+	socket.WriteMessage(1, b)
+}
+
+// errorMsg reports err to the UI. Errors saving or loading projects get their
+// own type so the UI can keep showing them until they're dismissed.
+func errorMsg(err error) WSMessage {
+	msg := WSMessage{
+		Type: "error",
+		Data: err.Error(),
+	}
+	if _, ok := err.(*fixme.StoreError); ok {
+		msg.Type = "store_error"
+	}
+	return msg
 }
 
-func getPackagesByName(req WSMessage, p *fixme.Project) WSMessage {
-	pkgs := fixme.PackageByName(req.Data)
+var handlers = map[string]func(WSMessage, *session) WSMessage{
+	"package_name":    getPackagesByName,
+	"set_name":        setProjectName,
+	"package_state":   setPackageState,
+	"new_project":     newProject,
+	"new_project_dir": newProjectFromDir,
+	"import_project":  importProjectFile,
+	"load_project":    loadProject,
+	"delete_project":  deleteProject,
+	"add_pattern":     addPattern,
+	"auto_pattern":    addPattern,
+	"rescan":          rescanPackages,
+	"open_editor":     openInEditor,
+	"rerun":           rerun,
+	"pause":           pause,
+	"resume":          resume,
+	"history":         history,
+	"past_run":        pastRun,
+}
+
+// searchLimit is the most packages a search will show in the UI.
+const searchLimit = 50
+
+func getPackagesByName(req WSMessage, s *session) WSMessage {
+	pkgs := fixme.Search(req.Data, s.proj, searchLimit)
 	pkgNames := make([]string, len(pkgs))
 	for i, pkg := range pkgs {
 		pkgNames[i] = pkg.Import
@@ -202,54 +476,240 @@ func getPackagesByName(req WSMessage, p *fixme.Project) WSMessage {
 
 }
 
-func setProjectName(req WSMessage, p *fixme.Project) WSMessage {
-	p.Name = req.Data
-	p.Save()
+// rescanPackages rebuilds the package index in the background, searches keep
+// using the old index until it's done.
+func rescanPackages(req WSMessage, s *session) WSMessage {
+	go fixme.Rescan()
+	return WSMessage{
+		Type: "rescan",
+	}
+}
+
+// openInEditor opens the file in req.Package at the "line:col" in req.Data.
+func openInEditor(req WSMessage, s *session) WSMessage {
+	d := fixme.Diagnostic{
+		File: req.Package,
+	}
+	fmt.Sscanf(req.Data, "%d:%d", &d.Line, &d.Column)
+	if err := fixme.OpenInEditor(*editor, d); err != nil {
+		return errorMsg(err)
+	}
+	return WSMessage{}
+}
+
+// rerun checks the package in req.Package, or every package if it's empty.
+func rerun(req WSMessage, s *session) WSMessage {
+	if req.Package == "" {
+		s.proj.Rerun()
+	} else {
+		s.proj.RerunPackage(req.Package)
+	}
+	return WSMessage{}
+}
+
+func pause(req WSMessage, s *session) WSMessage {
+	s.proj.Pause()
+	return WSMessage{
+		Type: "paused",
+	}
+}
+
+func resume(req WSMessage, s *session) WSMessage {
+	s.proj.Resume()
+	return WSMessage{
+		Type: "resumed",
+	}
+}
+
+// historyLimit is the most runs the history in the UI lists.
+const historyLimit = 50
+
+// history lists the project's recent runs, newest first.
+func history(req WSMessage, s *session) WSMessage {
+	runs, err := s.proj.History(historyLimit)
+	if err != nil {
+		return errorMsg(err)
+	}
+	data, _ := json.Marshal(runs)
+	return WSMessage{
+		Type: "history",
+		Data: string(data),
+	}
+}
+
+// pastRun returns the run with the ID in req.Data, with its output.
+func pastRun(req WSMessage, s *session) WSMessage {
+	id, err := strconv.ParseUint(req.Data, 10, 64)
+	if err != nil {
+		return errorMsg(err)
+	}
+	run, err := s.proj.PastRun(id)
+	if err != nil {
+		return errorMsg(err)
+	}
+	data, _ := json.Marshal(run)
+	return WSMessage{
+		Type: "past_run",
+		Data: string(data),
+	}
+}
+
+func setProjectName(req WSMessage, s *session) WSMessage {
+	s.proj.SetName(req.Data)
+	if err := s.proj.Save(); err != nil {
+		return errorMsg(err)
+	}
 	return WSMessage{}
 }
 
-func setPackageState(req WSMessage, p *fixme.Project) WSMessage {
+func setPackageState(req WSMessage, s *session) WSMessage {
 	pkg := fixme.PackageByImport(req.Package)
 	if pkg == nil {
 		return WSMessage{}
 	}
-	var action = map[string]func(*fixme.Package){
+	p := s.proj
+	var action = map[string]func(*fixme.Package) error{
 		"none":  p.Remove,
 		"test":  p.AddTest,
 		"lint":  p.AddLint,
 		"watch": p.AddWatch,
 	}
 	if update, ok := action[req.Data]; ok {
-		update(pkg)
+		err := update(pkg)
 		p.ResolveDependancies()
 		p.DoUpdate()
+		if err != nil {
+			return errorMsg(err)
+		}
 	}
 	return WSMessage{}
 }
 
-func newProject(req WSMessage, p *fixme.Project) WSMessage {
-	p.Close()
-	*p = *(fixme.NewProject())
-	p.Run()
-	p.DoUpdate()
+func newProject(req WSMessage, s *session) WSMessage {
+	s.setProject(fixme.NewProject())
+	s.proj.Run()
 	return WSMessage{
 		Type: "new_project",
-		Data: string(p.JSON()),
+		Data: string(s.proj.JSON()),
 	}
 }
 
-func loadProject(req WSMessage, p *fixme.Project) WSMessage {
-	*p = *(fixme.Load(req.ID))
-	p.Run()
+func newProjectFromDir(req WSMessage, s *session) WSMessage {
+	np, err := fixme.NewProjectFromDir(req.Data)
+	if err != nil {
+		return errorMsg(err)
+	}
+	s.setProject(np)
+	np.ResolveDependancies()
+	np.Run()
+	return WSMessage{
+		Type: "new_project",
+		Data: string(np.JSON()),
+	}
+}
+
+// importProjectFile creates a project from the file contents in req.Data,
+// req.Package is the file name. The browser doesn't say where the file was, so
+// packages with relative paths have to be found by import path and relative
+// patterns are left out. Those are listed in Missing along with packages that
+// couldn't be found.
+func importProjectFile(req WSMessage, s *session) WSMessage {
+	np, missing, err := fixme.Import([]byte(req.Data), fixme.ExportFormat(req.Package), "")
+	if err != nil {
+		return errorMsg(err)
+	}
+	s.setProject(np)
+	np.ResolveDependancies()
+	np.Run()
+	return WSMessage{
+		Type:    "new_project",
+		Data:    string(np.JSON()),
+		Missing: missing,
+	}
+}
+
+// exportHandler downloads the project with the base64 id in the query, as yaml
+// unless format=json is given.
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := base64.StdEncoding.DecodeString(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "bad project id", http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "json" {
+		format = "yaml"
+	}
+	pr, err := fixme.LoadRecord(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	data, err := fixme.Export(pr, format, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportName(pr.Name)+"."+format))
+	w.Write(data)
+}
+
+// exportName makes a project name safe to use as a file name.
+func exportName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == '"' || r < ' ' {
+			return '-'
+		}
+		return r
+	}, name)
+	if name == "" {
+		return "project"
+	}
+	return name
+}
+
+func loadProject(req WSMessage, s *session) WSMessage {
+	p, err := fixme.Load(req.ID)
+	if err != nil {
+		return errorMsg(err)
+	}
+	s.setProject(p)
 	p.ResolveDependancies()
-	p.DoUpdate()
+	p.Run()
 	return WSMessage{
 		Type: "load",
 		Data: string(p.JSON()),
 	}
 }
 
-func deleteProject(req WSMessage, p *fixme.Project) WSMessage {
-	p.Delete()
-	return loadProject(WSMessage{}, p)
+func deleteProject(req WSMessage, s *session) WSMessage {
+	if err := s.proj.Delete(); err != nil {
+		return errorMsg(err)
+	}
+	return loadProject(WSMessage{}, s)
+}
+
+// addPattern adds all the packages matching req.Package with the action in
+// req.Data. An auto_pattern request also keeps the pattern so new packages
+// are picked up.
+func addPattern(req WSMessage, s *session) WSMessage {
+	action, ok := fixme.ParseAction(req.Data)
+	if !ok || action == fixme.None {
+		return WSMessage{}
+	}
+	p := s.proj
+	_, err := p.AddPattern(fixme.Pattern{
+		Pattern: req.Package,
+		Action:  action,
+		Auto:    req.Type == "auto_pattern",
+	})
+	p.ResolveDependancies()
+	p.DoUpdate()
+	if err != nil {
+		return errorMsg(err)
+	}
+	return WSMessage{
+		Type: "load",
+		Data: string(p.JSON()),
+	}
 }
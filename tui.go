@@ -0,0 +1,346 @@
+package main
+
+import (
+	"fmt"
+	"github.com/adamcolton/fixme/fixme"
+	"github.com/nsf/termbox-go"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tuiMain runs fixme as a full screen terminal interface instead of the web
+// server. It shows the packages in a project with their states and the output
+// of the current failure. The project can be named in the args, otherwise the
+// first project is used.
+func tuiMain(args []string) {
+	proj, err := loadProjectByName(args)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	t := &tui{
+		proj: proj,
+	}
+	if err := termbox.Init(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer termbox.Close()
+	t.run()
+}
+
+func loadProjectByName(args []string) (*fixme.Project, error) {
+	if len(args) > 0 {
+		list, err := fixme.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range list {
+			if pr.Name == args[0] {
+				return fixme.Load(pr.ID)
+			}
+		}
+	}
+	return fixme.Load(nil)
+}
+
+const (
+	focusPackages = iota
+	focusOutput
+	focusProjects
+)
+
+type tui struct {
+	proj     *fixme.Project
+	pkgs     []*fixme.Package
+	selected int
+	focus    int
+	heading  string
+	output   []string
+	scroll   int
+	projects []fixme.ProjectRecord
+	projSel  int
+}
+
+const tuiHelp = "r rerun  space cycle action  x remove  p projects  tab switch pane  q quit"
+
+func (t *tui) run() {
+	events := make(chan termbox.Event)
+	go func() {
+		for {
+			events <- termbox.PollEvent()
+		}
+	}()
+
+	t.start()
+	for {
+		t.draw()
+		select {
+		case pkg := <-t.proj.Update:
+			// progress still in the buffer happened before the update
+			for len(t.proj.Progress) > 0 {
+				<-t.proj.Progress
+			}
+			t.setResult(pkg)
+		case pr := <-t.proj.Progress:
+			if pr.Kind == fixme.StepStarted {
+				t.heading = fmt.Sprintf("Running %s : %s (%d/%d)", pr.Step, pr.Package, pr.Index, pr.Total)
+			}
+		case ev := <-events:
+			if ev.Type == termbox.EventKey && t.key(ev) {
+				return
+			}
+		}
+	}
+}
+
+func (t *tui) start() {
+	t.pkgs = t.proj.Packages()
+	t.selected, t.scroll = 0, 0
+	t.heading = "Running..."
+	t.output = nil
+	t.proj.ResolveDependancies()
+	t.proj.Run()
+}
+
+func (t *tui) setResult(pkg *fixme.Package) {
+	t.pkgs = t.proj.Packages()
+	t.scroll = 0
+	if pkg == nil {
+		t.heading = time.Now().Format("15:04:05") + ") OK : nothing to report"
+		t.output = []string{"Good job, buddy!"}
+		return
+	}
+	t.heading = time.Now().Format("15:04:05") + ") " + pkg.State().String() + " : " + pkg.Import
+	t.output = nil
+	if len(pkg.Diagnostics) == 0 {
+		t.output = strings.Split(pkg.Data, "\n")
+		return
+	}
+	for _, d := range pkg.Diagnostics {
+		if rel, err := filepath.Rel(pkg.Path, d.File); err == nil {
+			d.File = rel
+		}
+		t.output = append(t.output, strings.Split(d.String(), "\n")...)
+		for _, l := range d.Context {
+			mark := "  "
+			if l.Highlight {
+				mark = "> "
+			}
+			t.output = append(t.output, fmt.Sprintf("%s%5d  %s", mark, l.Line, l.Text))
+		}
+		t.output = append(t.output, "")
+	}
+}
+
+// key handles a key press and returns true if the program should exit.
+func (t *tui) key(ev termbox.Event) bool {
+	if ev.Key == termbox.KeyCtrlC || ev.Ch == 'q' {
+		return true
+	}
+	if t.focus == focusProjects {
+		t.projectKey(ev)
+		return false
+	}
+
+	switch {
+	case ev.Key == termbox.KeyTab:
+		t.focus = 1 - t.focus
+	case ev.Ch == 'r':
+		t.rerun()
+	case ev.Ch == 'p':
+		projects, err := fixme.List()
+		if err != nil {
+			t.heading = err.Error()
+			break
+		}
+		t.projects = projects
+		t.projSel = 0
+		t.focus = focusProjects
+	case ev.Key == termbox.KeyArrowUp || ev.Ch == 'k':
+		t.move(-1)
+	case ev.Key == termbox.KeyArrowDown || ev.Ch == 'j':
+		t.move(1)
+	case ev.Key == termbox.KeyPgup:
+		t.scrollBy(-t.pageSize())
+	case ev.Key == termbox.KeyPgdn:
+		t.scrollBy(t.pageSize())
+	case ev.Key == termbox.KeySpace && t.selected < len(t.pkgs):
+		pkg := t.pkgs[t.selected]
+		var cycle = map[fixme.Action]func(*fixme.Package) error{
+			fixme.Watch: t.proj.AddTest,
+			fixme.Test:  t.proj.AddLint,
+			fixme.Lint:  t.proj.AddWatch,
+		}
+		if update, ok := cycle[pkg.Action]; ok {
+			err := update(pkg)
+			t.rerun()
+			t.showErr(err)
+		}
+	case ev.Ch == 'x' && t.selected < len(t.pkgs):
+		err := t.proj.Remove(t.pkgs[t.selected])
+		t.pkgs = t.proj.Packages()
+		if t.selected >= len(t.pkgs) && t.selected > 0 {
+			t.selected--
+		}
+		t.rerun()
+		t.showErr(err)
+	}
+	return false
+}
+
+func (t *tui) projectKey(ev termbox.Event) {
+	switch {
+	case ev.Key == termbox.KeyEsc:
+		t.focus = focusPackages
+	case ev.Key == termbox.KeyArrowUp || ev.Ch == 'k':
+		if t.projSel > 0 {
+			t.projSel--
+		}
+	case ev.Key == termbox.KeyArrowDown || ev.Ch == 'j':
+		if t.projSel < len(t.projects)-1 {
+			t.projSel++
+		}
+	case ev.Key == termbox.KeyEnter && t.projSel < len(t.projects):
+		proj, err := fixme.Load(t.projects[t.projSel].ID)
+		t.focus = focusPackages
+		if err != nil {
+			t.heading = err.Error()
+			return
+		}
+		t.proj.Close()
+		t.proj = proj
+		t.start()
+	}
+}
+
+// showErr puts err in the heading, where it stays until the run reports.
+func (t *tui) showErr(err error) {
+	if err != nil {
+		t.heading = err.Error()
+	}
+}
+
+func (t *tui) rerun() {
+	t.heading = "Running..."
+	t.proj.ResolveDependancies()
+	t.proj.Rerun()
+}
+
+func (t *tui) move(d int) {
+	if t.focus == focusOutput {
+		t.scrollBy(d)
+		return
+	}
+	t.selected += d
+	if t.selected >= len(t.pkgs) {
+		t.selected = len(t.pkgs) - 1
+	}
+	if t.selected < 0 {
+		t.selected = 0
+	}
+}
+
+func (t *tui) scrollBy(d int) {
+	t.scroll += d
+	if max := len(t.output) - t.pageSize(); t.scroll > max {
+		t.scroll = max
+	}
+	if t.scroll < 0 {
+		t.scroll = 0
+	}
+}
+
+func (t *tui) pageSize() int {
+	_, h := termbox.Size()
+	return h - 2
+}
+
+var stateColors = map[string]termbox.Attribute{
+	"Build":   termbox.ColorRed,
+	"Test":    termbox.ColorYellow,
+	"Lint":    termbox.ColorCyan,
+	"Passing": termbox.ColorGreen,
+}
+
+// actionLetters are shown next to each package, "?" for an action not listed.
+var actionLetters = map[fixme.Action]string{
+	fixme.None:  "N",
+	fixme.Watch: "W",
+	fixme.Test:  "T",
+	fixme.Lint:  "L",
+}
+
+func (t *tui) draw() {
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	w, h := termbox.Size()
+
+	tuiPrint(0, 0, w, termbox.AttrBold, termbox.ColorDefault, t.proj.Name()+" | "+t.heading)
+	tuiPrint(0, h-1, w, termbox.ColorDefault, termbox.ColorDefault, tuiHelp)
+
+	lw := w / 3
+	for i, pkg := range t.pkgs {
+		y := i + 1
+		if y >= h-1 {
+			break
+		}
+		fg, bg := termbox.ColorDefault, termbox.ColorDefault
+		if i == t.selected {
+			if t.focus == focusPackages {
+				fg |= termbox.AttrReverse
+			} else {
+				fg |= termbox.AttrBold
+			}
+		}
+		action, ok := actionLetters[pkg.Action]
+		if !ok {
+			action = "?"
+		}
+		tuiPrint(0, y, 4, fg, bg, "["+action+"]")
+		state := pkg.State().String()
+		tuiPrint(lw-8, y, 8, stateColors[state], bg, state)
+		tuiPrint(4, y, lw-13, fg, bg, pkg.Import)
+	}
+	for y := 1; y < h-1; y++ {
+		termbox.SetCell(lw, y, '│', termbox.ColorDefault, termbox.ColorDefault)
+	}
+	for i := t.scroll; i < len(t.output) && i-t.scroll < h-2; i++ {
+		tuiPrint(lw+2, i-t.scroll+1, w-lw-2, termbox.ColorDefault, termbox.ColorDefault, t.output[i])
+	}
+
+	if t.focus == focusProjects {
+		t.drawProjects(w, h)
+	}
+	termbox.Flush()
+}
+
+func (t *tui) drawProjects(w, h int) {
+	bw, bh := w/2, len(t.projects)+2
+	x, y := (w-bw)/2, (h-bh)/2
+	for row := y; row < y+bh; row++ {
+		tuiPrint(x, row, bw, termbox.ColorDefault, termbox.ColorBlue, strings.Repeat(" ", bw))
+	}
+	tuiPrint(x+1, y, bw-2, termbox.AttrBold, termbox.ColorBlue, "Projects (enter to load, esc to cancel)")
+	for i, pr := range t.projects {
+		fg := termbox.ColorWhite
+		if i == t.projSel {
+			fg |= termbox.AttrReverse
+		}
+		tuiPrint(x+1, y+i+1, bw-2, fg, termbox.ColorBlue, pr.Name)
+	}
+}
+
+// tuiPrint writes s at x, y without going past w cells.
+func tuiPrint(x, y, w int, fg, bg termbox.Attribute, s string) {
+	s = strings.Replace(s, "\t", "    ", -1)
+	i := 0
+	for _, r := range s {
+		if i >= w {
+			return
+		}
+		termbox.SetCell(x+i, y, r, fg, bg)
+		i++
+	}
+}